@@ -10,6 +10,7 @@ import (
 
 type About struct {
 	SiteGlobal
+	PageData
 	Body  template.HTML
 	Title string
 }
@@ -46,6 +47,7 @@ func getAbout() (*About, error) {
 
 	about := new(About)
 	about.SiteGlobal = siteGlobal
+	about.PageData = newPageData()
 	about.Body = template.HTML(body_markdown)
 	about.Title = "About"
 
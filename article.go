@@ -2,26 +2,30 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/russross/blackfriday"
 	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"path"
 	"regexp"
 	"sort"
-	"strings"
+	"strconv"
+	"time"
 )
 
 type Article struct {
 	SiteGlobal
+	// Set per request, the cached article does not have it
+	PageData
 
 	// Following are not from the file
 	Id   string
 	Link string
+	// Body as plain text without markup or LaTeX, used for searching
+	PlainText string
 
 	// Following are parsed from the files
 	Body         template.HTML
@@ -32,7 +36,21 @@ type Article struct {
 	DateModified ParsableTime
 	Icon         string
 	Tags         []string
+	Series       ArticleSeries
 	Comments     *[]Comment
+	// Approved comments arranged by replies
+	CommentThreads []*CommentThread
+	// Set if the comments could not be read, the article is shown
+	// without comments until they can be read again
+	CommentsError error
+
+	// Other parts of the series, filled when the article is shown
+	SeriesParts []*Article
+	SeriesPrev  *Article
+	SeriesNext  *Article
+
+	// Listed articles with similar tags and content, most related first
+	RelatedArticles []*Article
 
 	// If user tries to add comment, this will be
 	// filled with data
@@ -41,6 +59,46 @@ type Article struct {
 	// Options which read from the file, and affect how the data is processed
 	// but should not be displayed on the final HTML
 	CreateToc bool
+
+	// New comments are not accepted, either always or after the number
+	// of days from DateCreated
+	CommentsClosed         bool
+	CloseCommentsAfterDays int
+
+	// Publication status, one of the articleStatus* values. Empty status
+	// means that the article is published.
+	Status string
+	// When scheduled article will be published
+	PublishAt ParsableTime
+}
+
+const (
+	// Only visible to admin
+	articleStatusDraft = "draft"
+	// Visible to admin until PublishAt, after that as published
+	articleStatusScheduled = "scheduled"
+	// Visible to everyone with the link, but not in listings or feeds
+	articleStatusUnlisted  = "unlisted"
+	articleStatusPublished = "published"
+)
+
+// Returns true if article should be shown in listings and feeds
+func (article *Article) IsListed() bool {
+	switch article.Status {
+	case "", articleStatusPublished:
+		return true
+	case articleStatusScheduled:
+		return !time.Now().Before(article.PublishAt.Time)
+	}
+	return false
+}
+
+// Returns true if the article can be viewed with its own URL
+func (article *Article) IsVisibleTo(cookie *SiteCookie) bool {
+	if article.IsListed() || article.Status == articleStatusUnlisted {
+		return true
+	}
+	return cookie.IsAdmin()
 }
 
 var validArticle = regexp.MustCompile("^/(article)/([a-zA-Z0-9_]+)$")
@@ -50,7 +108,10 @@ var articleScripts = template.HTML(`
  Mathjax
 ************-->
 <script type="text/x-mathjax-config">
-    MathJax.Hub.Config({"HTML-CSS": {
+    // Comments are typeset too, the Safe extension keeps math in them
+    // from adding javascript links and styles after the sanitizing
+    MathJax.Hub.Config({extensions: ["Safe.js"],
+        "HTML-CSS": {
         preferredFont: "TeX", availableFonts: ["STIX","TeX"], linebreaks: { automatic:true }},
         tex2jax: { inlineMath: [ ["$", "$"], ["\\\\(","\\\\)"] ], displayMath: [ ["$$","$$"], ["\\[", "\\]"] ], processEscapes: true, ignoreClass: "tex2jax_ignore|dno" },
         TeX: {
@@ -94,28 +155,47 @@ var articleScripts = template.HTML(`
     }
 </script>
 <!--***********
- Initialization code
+ Comment preview
 ************-->
 <script>
-    $(document).ready(function(){
-        InitAutoImageCaption();
-        hljs.initHighlightingOnLoad();
-		showRecaptcha();
-    });
+    var commentPreviewTimer = null;
+    function PreviewComment() {
+        // Wait until the user stops typing
+        clearTimeout(commentPreviewTimer);
+        commentPreviewTimer = setTimeout(function() {
+            $.post("/comment/preview", {comment: $("textarea[name=comment]").val()}, function(html) {
+                $("#newcomment-preview").html(html);
+                $("#newcomment-preview pre code").each(function(idx, block) {
+                    hljs.highlightBlock(block);
+                });
+                MathJax.Hub.Queue(["Typeset", MathJax.Hub, "newcomment-preview"]);
+            });
+        }, 500);
+    }
 </script>
 <!--***********
- Recaptcha
+ Comment form token, tells when the page was loaded
 ************-->
-<script type="text/javascript" src="http://www.google.com/recaptcha/api/js/recaptcha_ajax.js"></script>
 <script>
-function showRecaptcha() {
-	Recaptcha.create("6LdVRvcSAAAAAAOqeWSPRmZmvBSZZpZ2spv6L_fd",
-    "captchadiv",
-    {
-      theme: "red"
+    function LoadFormToken() {
+        if ($("input[name=form_token]").length == 0) {
+            return;
+        }
+        $.ajax({url: "/comment/token", cache: false}).done(function(token) {
+            $("input[name=form_token]").val(token);
+        });
     }
-  );
-}
+</script>
+<!--***********
+ Initialization code
+************-->
+<script>
+    $(document).ready(function(){
+        InitAutoImageCaption();
+        hljs.initHighlightingOnLoad();
+        $("textarea[name=comment]").on("input", PreviewComment);
+        LoadFormToken();
+    });
 </script>
 `)
 
@@ -146,16 +226,14 @@ func GetArticleFolder() string {
 	return siteGlobal.ContentRoot + "/" + articleFolder
 }
 
+// Returns all articles which should be listed, newest first
 func GetAllArticles() []*Article {
-	ids := getAllArticleIds()
-	articles := make([]*Article, len(ids))
-
-	for idx, id := range ids {
-		articles[idx], _ = NewArticle(id)
+	articles := []*Article{}
+	for _, article := range articleStore.All() {
+		if article.IsListed() {
+			articles = append(articles, article)
+		}
 	}
-
-	sort.Sort(ByCreationDateNewestFirst(articles))
-
 	return articles
 }
 
@@ -173,7 +251,7 @@ func GetArticlesByTag(tag string) ([]*Article, error) {
 
 	articles := []*Article{}
 	for _, article := range articles_all {
-		if stringInSlice(tag, article.Tags) {
+		if hasTag(article.Tags, tag) {
 			articles = append(articles, article)
 		}
 	}
@@ -186,6 +264,7 @@ func GetArticlesByTag(tag string) ([]*Article, error) {
 func SplitRawArticlesIntoColumns(articles_raw []*Article) Articles {
 	articles := Articles{}
 	articles.SiteGlobal = siteGlobal
+	articles.PageData = newPageData()
 
 	// Every other goes to left column, every other to right column
 	for idx, article := range articles_raw {
@@ -209,6 +288,9 @@ func NewArticle(id string) (*Article, error) {
 
 	article := new(Article)
 	err = parseRawTextArticleData(article_data, article)
+	if parse_err, ok := err.(*ArticleParseError); ok {
+		parse_err.File = filename
+	}
 	// Save HeadAfterScripts from overwriting
 	additional_scripts := article.HeadAfterScripts;
 
@@ -218,7 +300,10 @@ func NewArticle(id string) (*Article, error) {
 	article.Scripts = articleScripts
 	article.Link = websiteAddress() + "/article/" + article.Id
 	article.Keywords = article.Tags
-	article.Comments, _ = GetComments(id)
+	if comments_err := loadComments(article); comments_err != nil {
+		// Article is shown without comments, see ArticleStore.Get
+		log.Print("Failed to read comments of article " + id + ": " + comments_err.Error())
+	}
 	article.HeadAfterScripts = additional_scripts;
 
 	return article, err
@@ -258,12 +343,14 @@ func escapeLatexInner(input []byte) []byte {
 	return tmp
 }
 
+// (?s) sets dot to match new lines
+// Matches all text which is between $+ tags
+// This is not perfect, but good enough for my use
+var latexBlock = regexp.MustCompile("(?s)\\$+(.+?)\\$+")
+
 func escapeLatex(input []byte) []byte {
-	// (?s) sets dot to match new lines
-	// Escape all text which is between $+ tags
-	// This is not perfect, but good enough for my use
-	re := regexp.MustCompile("(?s)\\$+(.+?)\\$+")
-	output := re.ReplaceAllFunc(input, escapeLatexInner)
+	// Escape all LaTeX blocks
+	output := latexBlock.ReplaceAllFunc(input, escapeLatexInner)
 	return output
 }
 
@@ -304,35 +391,21 @@ func parseArticleBodyToHtml(article_body_data []byte, article Article) template.
 	return template.HTML(body_markdown)
 }
 
+// Parses meta data and body of the article. Meta data can be JSON followed
+// by a separator line, or YAML/TOML front matter. Returns *ArticleParseError
+// if the meta data can not be parsed, the body is parsed in any case.
 func parseRawTextArticleData(article_data []byte, article *Article) error {
-	// Find meta and body separator
-	article_header_separator := "---------- META END ----------"
-	separator_len := len(article_header_separator)
-	separator_begin := strings.Index(string(article_data), article_header_separator)
-
 	// Separate meta and body data
-	article_body_data := []byte{}
-	article_meta_data := []byte{}
-
-	if separator_begin > 0 {
-		// Found separator, split the data into meta data and body data
-		article_meta_data = article_data[:separator_begin-1]
-		article_body_data = article_data[separator_begin+separator_len:]
-	} else {
-		// Did not find separator, meta data is empty
-		article_body_data = article_data
-	}
+	format, article_meta_data, article_body_data, line_offset := splitFrontMatter(article_data)
 
 	// Read metadata
-	err := json.Unmarshal(article_meta_data, article)
-	if err != nil {
-		fmt.Println("Failed to parse article meta data. Returning empty meta data: " + err.Error())
-	}
+	err := parseArticleMeta(format, article_meta_data, line_offset, article)
 
 	// Parse article body to valid HTML (which is safe)
 	article.Body = parseArticleBodyToHtml(article_body_data, *article)
+	article.PlainText = markdownToPlainText(article_body_data)
 
-	return nil
+	return err
 }
 
 func getArticleId(r *http.Request) (string, error) {
@@ -351,14 +424,51 @@ func articleHandler(w http.ResponseWriter, r *http.Request) {
 		log.Print("Could not parse article Id from request:" + err.Error())
 		return
 	}
-	article, err := NewArticle(id)
-	if err != nil {
+	cached, err := articleStore.Get(id)
+	if cached == nil {
+		if !os.IsNotExist(err) {
+			log.Print("Failed to load article " + id + ": " + err.Error())
+			http.Error(w, "Failed to load the article", http.StatusInternalServerError)
+			return
+		}
 		http.NotFound(w, r)
 		log.Print("Unknown article Id:" + id)
 		return
 	}
+	if !cached.IsVisibleTo(getCookie(r)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Cached article is shared, comment handling modifies the article
+	article := new(Article)
+	*article = *cached
+	article.PageData = newPageData()
+
+	fillSeriesNavigation(article)
+	fillRelatedArticles(article)
+
+	// Comments close by age without the cached article changing
+	if !canReply(article) {
+		article.CommentThreads = buildCommentThreads(*article.Comments, false)
+	}
 
-	article, err = CheckNewComment(r, article)
+	article, err = CheckNewComment(w, r, article)
+	if article.NewComment.Closed {
+		if !acceptsHtml(r) {
+			http.Error(w, article.CommentsClosedReason(), http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}
+	if article.NewComment.RateLimited {
+		w.Header().Set("Retry-After", strconv.Itoa(article.NewComment.RetryAfter))
+		if !acceptsHtml(r) {
+			http.Error(w, "Too many comments, try again later", http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
 
 	renderTemplate(w, "article", *article)
 }
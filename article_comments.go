@@ -1,26 +1,64 @@
 package main
 
 import (
-	"encoding/json"
-	"github.com/dpapathanasiou/go-recaptcha"
-	"io/ioutil"
+	"html/template"
 	"log"
+	"math"
 	"net/http"
-	"os"
-	"sync"
+	"net/mail"
+	"strings"
 	"time"
 )
 
 type Comment struct {
+	Id          string
 	Name        string
 	CommentBody string
 	TimeStamp   ParsableTime
+	// One of the commentStatus* values, empty for old comments
+	Status string
+	// Random id from the commenter cookie
+	CommenterId string `json:",omitempty"`
+	// Id of the comment this replies to, empty for top level comments
+	ParentId string
+	// Written while logged in as admin
+	ByAdmin bool
+	// Why the spam filter did not approve the comment
+	SpamReason string
+	// Only stored for reply notifications, never shown on the site
+	Email string `json:",omitempty"`
+	// Hash of the optional email, see hashEmail
+	EmailHash string
+	// Email is sent when someone replies in the same thread
+	NotifyReplies bool
+	// Set when the commenter edits the comment, see editComment
+	Edited    *ParsableTime     `json:",omitempty"`
+	Revisions []CommentRevision `json:",omitempty"`
+	// Decision the spam classifier was trained with, one of the
+	// spamTrained* values, empty if the classifier has not seen the comment
+	SpamTrained string `json:",omitempty"`
+	// Body rendered once when the comments of the article are read
+	BodyHtml template.HTML `json:"-"`
 }
 
 type NewComment struct {
 	Comment
-	RecaptchaOk    bool
+	CaptchaOk      bool
 	TriedToComment bool
+	// Comment was added but is not shown before approval
+	Pending bool
+	// Comment which is replied to, nil if not a reply
+	ReplyTo *Comment
+	// Allows the commenter to edit the added comment for EditMinutes
+	EditToken   string
+	EditMinutes int
+	// Commenting on the article is closed, see CommentsClosedReason
+	Closed bool
+	// Name is the site owner's but the commenter is not admin
+	NameReserved bool
+	// Too many comments, seconds until commenting is allowed again
+	RateLimited bool
+	RetryAfter  int
 }
 
 type Comments struct {
@@ -32,121 +70,154 @@ const (
 	commentExtension = ".txt"
 )
 
-var (
-	mutexCommentWriters sync.Mutex
-)
+func GetCommentFolder() string {
+	return siteGlobal.ContentRoot + "/" + commentFolder
+}
 
 func GetCommentFilename(id string) string {
-	return siteGlobal.ContentRoot + "/" + commentFolder + "/" + id + commentExtension
+	return GetCommentFolder() + "/" + id + commentExtension
 }
 
+// Returns approved comments of the article
 func GetComments(id string) (*[]Comment, error) {
-	comments := new(Comments)
-
-	// Try to find the data to the comments with certain id
-	filename := GetCommentFilename(id)
-	comment_data, err := ioutil.ReadFile(filename)
+	comments, err := commentStore.List(id)
 	if err != nil {
-		// File does not exist
-		// Return empty comments
-		return &comments.Comments, nil
+		return nil, err
 	}
-
-	err = json.Unmarshal(comment_data, &comments)
-	if err != nil {
-		log.Print("Failed to parse comment data. Returning empty comments: " + err.Error())
+	comments = approvedComments(comments)
+	for idx := range comments {
+		comments[idx].BodyHtml = commentMarkdownToHtml(comments[idx].CommentBody)
 	}
-
-	return &comments.Comments, err
+	return &comments, nil
 }
 
-func AddComment(id string, comment Comment) error {
-	// Adding comment to a file needs a lock
-	// This could be per article, but I don't think that
-	// there will be so many comments per seconds...
-	mutexCommentWriters.Lock()
-	defer mutexCommentWriters.Unlock()
-
-	// Get old comments
-	comments, err := GetComments(id)
-	if err != nil {
-		return err
-	}
-
-	// Add new
-	commentsAppended := append(*comments, comment)
-
-	// Add to comments and marshal
-	commentsAll := Comments{commentsAppended}
-	bytes, err := json.MarshalIndent(commentsAll, "", "    ")
-	if nil != err {
-		return err
+func AddComment(id string, comment Comment) (Comment, error) {
+	comment, err := commentStore.Add(id, comment)
+	if err == nil {
+		if !comment.IsApproved() {
+			log.Println("New comment awaits moderation: /admin/comments")
+		}
+		notifyNewComment(id, comment)
+		if comment.IsApproved() {
+			notifyReplySubscribers(id, comment)
+		}
 	}
-	filename := GetCommentFilename(id)
 
-	// Check if file exists
-	_, err = os.Stat(filename)
-	if os.IsNotExist(err) {
-		err = nil
-		log.Println("Creating comment file for article: " + id)
+	// Do not wait for the watcher to notice the change
+	articleStore.Invalidate(id)
 
-		// Create the file
-		file, err := os.Create(filename)
-		if nil != err {
-			log.Print("failed to create comment file: " + err.Error())
-		}
+	return comment, err
+}
 
-		_, err = file.Write(bytes)
-		file.Close()
-	} else {
-		// Just overwrite existing
-		err = ioutil.WriteFile(filename, bytes, 0644)
+// Returns the address without the name part, empty if the address is
+// not valid
+func parseCommentEmail(email string) string {
+	if len(strings.TrimSpace(email)) == 0 {
+		return ""
 	}
-
-	return err
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		log.Print("Invalid email address in comment: " + err.Error())
+		return ""
+	}
+	return address.Address
 }
 
-func CheckNewComment(r *http.Request, article *Article) (*Article, error) {
+func CheckNewComment(w http.ResponseWriter, r *http.Request, article *Article) (*Article, error) {
 	err := error(nil)
 	newComment := NewComment{}
 	newComment.Name = r.FormValue("user")
 	newComment.CommentBody = r.FormValue("comment")
+	newComment.Email = parseCommentEmail(r.FormValue("email"))
+	newComment.NotifyReplies = len(newComment.Email) > 0 && len(r.FormValue("notify")) > 0
+	newComment.ByAdmin = getCookie(r).IsAdmin()
 	newComment.TimeStamp = ParsableTime{time.Now()}
+	newComment.ReplyTo = getReplyTo(r, article)
+	if newComment.ReplyTo != nil {
+		newComment.ParentId = newComment.ReplyTo.Id
+	}
 
 	if len(newComment.Name) > 0 || len(newComment.CommentBody) > 0 {
 		newComment.TriedToComment = true
 	}
 
 	if newComment.TriedToComment {
-		recaptcha.Init(siteGlobal.RecaptchaPrivateKey)
+		if article.AreCommentsClosed() {
+			log.Println("Tried to comment but comments are closed: " + article.Id)
+			newComment.Closed = true
+			article.NewComment = newComment
+			return article, nil
+		}
+		if !newComment.ByAdmin && isReservedName(newComment.Name) {
+			log.Println("Tried to comment with the name of the site owner")
+			newComment.NameReserved = true
+			article.NewComment = newComment
+			return article, nil
+		}
 
-		challenge, challenge_found := r.Form["recaptcha_challenge_field"]
-		recaptcha_resp, resp_found := r.Form["recaptcha_response_field"]
-		if challenge_found && resp_found {
-			newComment.RecaptchaOk = recaptcha.Confirm("127.0.0.1", challenge[0], recaptcha_resp[0])
-		} else {
-			log.Print("Tried to comment but not all Recaptcha fields have been filled")
+		id, _ := getArticleId(r)
+		if allowed, wait := allowComment(r, id); !allowed {
+			log.Println("Too many comments from " + clientIp(r) + " or to article " + id)
+			newComment.RateLimited = true
+			newComment.RetryAfter = int(math.Ceil(wait.Seconds()))
+			article.NewComment = newComment
+			return article, nil
 		}
+
+		captcha_ok, captcha_err := captchaVerifier.Verify(r, clientIp(r))
+		if captcha_err != nil {
+			log.Print("Failed to verify captcha: " + captcha_err.Error())
+		}
+		newComment.CaptchaOk = captcha_ok
 	}
 
-	if newComment.TriedToComment && newComment.RecaptchaOk {
+	if newComment.TriedToComment && newComment.CaptchaOk {
 		log.Println("Adding comment")
 		id, _ := getArticleId(r)
-		err = AddComment(id, newComment.Comment)
+		newComment.CommenterId = getCommenterId(r)
+		if len(newComment.CommenterId) == 0 {
+			newComment.CommenterId = newCommentId()
+		}
+		newComment.Status = newCommentStatus(newComment.CommenterId)
+		if newComment.ByAdmin {
+			newComment.Name = websiteAuthor()
+			newComment.Status = commentStatusApproved
+		} else {
+			applySpamResult(&newComment.Comment, checkSpam(r, newComment.Comment))
+		}
+		comment := newComment.Comment
+		if len(comment.Email) > 0 {
+			comment.EmailHash = hashEmail(comment.Email)
+		}
+		if !comment.NotifyReplies {
+			comment.Email = ""
+		}
+		comment, err = AddComment(id, comment)
 		if nil != err {
 			log.Println("Failed to add new comment: " + err.Error())
 		} else {
+			setCommenterCookie(w, newComment.CommenterId)
+			// Rejected comments are not announced to the spammer
+			newComment.Pending = comment.Status == commentStatusPending
+			newComment.EditToken = newEditToken(id, comment.Id)
+			newComment.EditMinutes = int(commentEditWindow().Minutes())
+
 			// Empty fields such that user does not try to resubmit
 			newComment.Name = ""
 			newComment.CommentBody = ""
+			newComment.Email = ""
+			newComment.NotifyReplies = false
+			newComment.ReplyTo = nil
 
 			// Reload comments
-			article.Comments, _ = GetComments(id)
+			if err := loadComments(article); err != nil {
+				log.Print("Failed to reload comments: " + err.Error())
+			}
 		}
 	} else if newComment.TriedToComment {
-		log.Println("Tried to comment but Recaptcha failed")
-	} else if newComment.RecaptchaOk {
-		log.Println("Recaptcha OK, but no comment")
+		log.Println("Tried to comment but captcha failed")
+	} else if newComment.CaptchaOk {
+		log.Println("Captcha OK, but no comment")
 	} else {
 		// No captha or comment
 	}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetCommentsRendersApprovedComments(t *testing.T) {
+	setupTestContent(t)
+	now := ParsableTime{time.Now()}
+	commentStore.Add("first", Comment{Name: "Reader", CommentBody: "*Nice*", TimeStamp: now,
+		Status: commentStatusApproved})
+	commentStore.Add("first", Comment{Name: "Spammer", CommentBody: "Buy", TimeStamp: now,
+		Status: commentStatusPending})
+
+	comments, err := GetComments("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*comments) != 1 {
+		t.Fatalf("%d comments returned", len(*comments))
+	}
+	if html := string((*comments)[0].BodyHtml); !strings.Contains(html, "<em>Nice</em>") {
+		t.Errorf("Body rendered as '%s'", html)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"io/ioutil"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keeps parsed articles in memory so that markdown and comments are only
+// parsed once per change instead of once per request. Entries are
+// invalidated when files in the article or comment folders change.
+type ArticleStore struct {
+	mutex    sync.RWMutex
+	articles map[string]cachedArticle
+	// All known article ids, nil if the folder needs to be read again
+	ids []string
+	// Incremented every time anything in the store is invalidated
+	generation uint64
+	// Time of the last invalidation, or creation of the store
+	modified time.Time
+}
+
+// Article with the error from parsing its meta data. Article with broken
+// meta data is shown with the meta data which could be parsed, and the
+// error is reported by lint.
+type cachedArticle struct {
+	article *Article
+	err     error
+}
+
+const (
+	defaultPollIntervalSeconds = 10
+)
+
+var (
+	articleStore = NewArticleStore()
+)
+
+func NewArticleStore() *ArticleStore {
+	store := new(ArticleStore)
+	store.articles = make(map[string]cachedArticle)
+	store.modified = time.Now()
+	return store
+}
+
+// Returns the cached article. The returned article is shared between
+// requests and must not be modified, make a copy first. The article is
+// returned also when its meta data has errors, it is nil only if the
+// article could not be read. Comments which could not be read are read
+// again on the next call, until then CommentsError of the article is set.
+func (store *ArticleStore) Get(id string) (*Article, error) {
+	store.mutex.RLock()
+	cached, found := store.articles[id]
+	generation := store.generation
+	store.mutex.RUnlock()
+	if found {
+		if cached.article != nil && cached.article.CommentsError != nil {
+			return store.reloadComments(id, cached, generation)
+		}
+		return cached.article, cached.err
+	}
+
+	// Parse outside of the lock, parsing might take a while
+	article, err := NewArticle(id)
+	if article == nil {
+		return nil, err
+	}
+	if err != nil {
+		// Logged once per change of the file, lint gives the details
+		log.Print("Article " + id + " has errors in meta data: " + err.Error())
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	// Only cache if nothing was invalidated while parsing, otherwise
+	// we might store an outdated article
+	if generation == store.generation {
+		store.articles[id] = cachedArticle{article, err}
+	}
+
+	return article, err
+}
+
+// Tries reading the comments of the cached article again, comments which
+// could not be read might be readable now
+func (store *ArticleStore) reloadComments(id string, cached cachedArticle, generation uint64) (*Article, error) {
+	article := new(Article)
+	*article = *cached.article
+	if loadComments(article) != nil {
+		return cached.article, cached.err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if generation == store.generation {
+		store.articles[id] = cachedArticle{article, cached.err}
+	}
+	return article, cached.err
+}
+
+func (store *ArticleStore) getIds() []string {
+	store.mutex.RLock()
+	ids := store.ids
+	generation := store.generation
+	store.mutex.RUnlock()
+	if ids != nil {
+		return ids
+	}
+
+	ids = getAllArticleIds()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if generation == store.generation {
+		store.ids = ids
+	}
+
+	return ids
+}
+
+// Returns all articles sorted newest first
+func (store *ArticleStore) All() []*Article {
+	ids := store.getIds()
+	articles := make([]*Article, 0, len(ids))
+
+	for _, id := range ids {
+		article, err := store.Get(id)
+		if article == nil {
+			log.Print("Failed to load article " + id + ": " + err.Error())
+			continue
+		}
+		articles = append(articles, article)
+	}
+
+	sort.Sort(ByCreationDateNewestFirst(articles))
+
+	return articles
+}
+
+// Number which changes every time the set of articles might have changed.
+// Can be used to know when data derived from the articles must be rebuilt.
+func (store *ArticleStore) Generation() uint64 {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.generation
+}
+
+// Returns when anything in the store was last invalidated. Content read
+// before the store was created is older than the store.
+func (store *ArticleStore) Modified() time.Time {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.modified
+}
+
+// Identifies the listed articles. The listing changes when the store
+// changes, or when the next scheduled article is published.
+type listingKey struct {
+	store      *ArticleStore
+	generation uint64
+	// Publish time of the next scheduled article, zero if none
+	nextPublish time.Time
+}
+
+// Returns key of the currently listed articles
+func (store *ArticleStore) ListingKey() listingKey {
+	key := listingKey{store: store, generation: store.Generation()}
+	now := time.Now()
+	for _, article := range store.All() {
+		if article.Status != articleStatusScheduled || !article.PublishAt.After(now) {
+			continue
+		}
+		if key.nextPublish.IsZero() || article.PublishAt.Before(key.nextPublish) {
+			key.nextPublish = article.PublishAt.Time
+		}
+	}
+	return key
+}
+
+// Returns true if the articles listed when the key was taken are still
+// the listed articles
+func (store *ArticleStore) IsListingCurrent(key listingKey) bool {
+	if key.store != store || key.generation != store.Generation() {
+		return false
+	}
+	return key.nextPublish.IsZero() || time.Now().Before(key.nextPublish)
+}
+
+// Index built from the listed articles, such as the search index. The
+// index is rebuilt lazily when the listed articles have changed.
+type listingIndex struct {
+	mutex sync.Mutex
+	build func(articles []*Article) interface{}
+	index interface{}
+	key   listingKey
+}
+
+func newListingIndex(build func(articles []*Article) interface{}) *listingIndex {
+	index := new(listingIndex)
+	index.build = build
+	return index
+}
+
+// Returns index of the listed articles, rebuilding it if needed
+func (index *listingIndex) Get() interface{} {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if index.index == nil || !articleStore.IsListingCurrent(index.key) {
+		// Key is taken before reading the articles such that changes
+		// during the build cause a new build on the next call
+		index.key = articleStore.ListingKey()
+		index.index = index.build(GetAllArticles())
+	}
+	return index.index
+}
+
+func (store *ArticleStore) Invalidate(id string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.articles, id)
+	// File might have been created or removed
+	store.ids = nil
+	store.generation++
+	store.modified = time.Now()
+}
+
+func (store *ArticleStore) InvalidateAll() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.articles = make(map[string]cachedArticle)
+	store.ids = nil
+	store.generation++
+	store.modified = time.Now()
+}
+
+// Invalidates the article which the file belongs to. Both article files
+// and comment files are named after the article id.
+func (store *ArticleStore) invalidateFile(filename string) {
+	ext := path.Ext(filename)
+	if ext != articleExtension && ext != commentExtension {
+		return
+	}
+	id := strings.TrimSuffix(path.Base(filename), ext)
+	store.Invalidate(id)
+}
+
+// Starts watching article and comment folders for changes. If file system
+// notifications are not available, falls back to polling.
+func (store *ArticleStore) Watch() {
+	folders := []string{GetArticleFolder(), GetCommentFolder()}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		for _, folder := range folders {
+			err = watcher.Add(folder)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Print("Could not watch content folders, polling instead: " + err.Error())
+		if watcher != nil {
+			watcher.Close()
+		}
+		go store.poll(folders, pollInterval())
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				store.invalidateFile(event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Events might have been lost, start from scratch
+				log.Print("Content folder watcher error: " + err.Error())
+				store.InvalidateAll()
+			}
+		}
+	}()
+}
+
+func pollInterval() time.Duration {
+	seconds := siteGlobal.PollIntervalSeconds
+	if seconds <= 0 {
+		seconds = defaultPollIntervalSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func getModificationTimes(folders []string) map[string]time.Time {
+	times := make(map[string]time.Time)
+	for _, folder := range folders {
+		files, err := ioutil.ReadDir(folder)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			times[folder+"/"+file.Name()] = file.ModTime()
+		}
+	}
+	return times
+}
+
+func (store *ArticleStore) poll(folders []string, interval time.Duration) {
+	times := getModificationTimes(folders)
+	for {
+		time.Sleep(interval)
+
+		new_times := getModificationTimes(folders)
+		for filename, new_time := range new_times {
+			old_time, found := times[filename]
+			if !found || !old_time.Equal(new_time) {
+				store.invalidateFile(filename)
+			}
+		}
+		for filename := range times {
+			if _, found := new_times[filename]; !found {
+				store.invalidateFile(filename)
+			}
+		}
+		times = new_times
+	}
+}
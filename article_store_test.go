@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArticleStoreCachesArticles(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+
+	article, err := articleStore.Get("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "First" {
+		t.Errorf("Title is '%s'", article.Title)
+	}
+	again, _ := articleStore.Get("first")
+	if again != article {
+		t.Error("Article was parsed again")
+	}
+
+	articleStore.Invalidate("first")
+	again, _ = articleStore.Get("first")
+	if again == article {
+		t.Error("Invalidated article was not parsed again")
+	}
+}
+
+func TestArticleStoreKeepsArticleWithMetaError(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "broken", `{"Title": "Broken", "DateCreated": 5}`, "Body")
+
+	article, err := articleStore.Get("broken")
+	if article == nil {
+		t.Fatal("Article with broken meta data was not returned")
+	}
+	if err == nil {
+		t.Error("Meta data error was not returned")
+	}
+	if article.Title != "Broken" {
+		t.Errorf("Title is '%s'", article.Title)
+	}
+
+	again, again_err := articleStore.Get("broken")
+	if again != article || again_err != err {
+		t.Error("Article with broken meta data was not cached with the error")
+	}
+
+	all := articleStore.All()
+	if len(all) != 1 || all[0] != article {
+		t.Errorf("All returned %d articles", len(all))
+	}
+}
+
+func TestArticleStoreMissingArticle(t *testing.T) {
+	setupTestContent(t)
+	article, err := articleStore.Get("missing")
+	if article != nil || err == nil {
+		t.Error("Missing article was returned")
+	}
+}
+
+func TestListingIndexRebuildsWhenListingChanges(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	writeTestArticle(t, "later", `{"Title": "Later", "DateCreated": "2020-01-02 10:00",
+		"Status": "scheduled", "PublishAt": "2100-01-01 10:00"}`, "Body")
+
+	num_builds := 0
+	index := newListingIndex(func(articles []*Article) interface{} {
+		num_builds++
+		return len(articles)
+	})
+
+	if num_listed := index.Get().(int); num_listed != 1 {
+		t.Errorf("%d articles listed", num_listed)
+	}
+	index.Get()
+	if num_builds != 1 {
+		t.Errorf("Index was built %d times", num_builds)
+	}
+	if index.key.nextPublish.Year() != 2100 {
+		t.Errorf("Next publish time is %v", index.key.nextPublish)
+	}
+
+	// Scheduled article is published without the store changing
+	index.key.nextPublish = time.Now().Add(-time.Second)
+	index.Get()
+	if num_builds != 2 {
+		t.Error("Index was not rebuilt when a scheduled article was published")
+	}
+
+	articleStore.Invalidate("first")
+	index.Get()
+	if num_builds != 3 {
+		t.Error("Index was not rebuilt when the store changed")
+	}
+}
+
+func TestArticleWithUnreadableCommentsIsShown(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	if err := ioutil.WriteFile(GetCommentFilename("first"), []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	article, err := articleStore.Get("first")
+	if article == nil || err != nil {
+		t.Fatalf("Article was not returned: %v", err)
+	}
+	if article.CommentsError == nil || len(*article.Comments) != 0 {
+		t.Error("Comment error was not set")
+	}
+	if all := articleStore.All(); len(all) != 1 {
+		t.Errorf("%d articles listed", len(all))
+	}
+
+	w := httptest.NewRecorder()
+	articleHandler(w, httptest.NewRequest("GET", "/article/first", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Status %d for article with unreadable comments", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Comments could not be loaded") {
+		t.Error("Comment error was not shown")
+	}
+
+	// Comments are read again once they are readable
+	if err = ioutil.WriteFile(GetCommentFilename("first"), []byte(`{"Comments": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := articleStore.Get("first")
+	if again.CommentsError != nil {
+		t.Error("Comments were not read again")
+	}
+	if cached, _ := articleStore.Get("first"); cached != again {
+		t.Error("Article with readable comments was not cached")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestArticleStatus(t *testing.T) {
+	old_config := config
+	defer func() { config = old_config }()
+	config.AdminEmail = "admin@example.com"
+	config.AdminId = "admin"
+	admin := &SiteCookie{"admin@example.com", "admin"}
+	visitor := &SiteCookie{}
+
+	past := ParsableTime{time.Now().Add(-time.Hour)}
+	future := ParsableTime{time.Now().Add(time.Hour)}
+	tests := []struct {
+		status     string
+		publish_at ParsableTime
+		listed     bool
+		visible    bool
+	}{
+		{"", ParsableTime{}, true, true},
+		{articleStatusPublished, ParsableTime{}, true, true},
+		{articleStatusDraft, ParsableTime{}, false, false},
+		{articleStatusUnlisted, ParsableTime{}, false, true},
+		{articleStatusScheduled, future, false, false},
+		{articleStatusScheduled, past, true, true},
+		{"unknown", ParsableTime{}, false, false},
+	}
+	for _, test := range tests {
+		article := &Article{Status: test.status, PublishAt: test.publish_at}
+		if article.IsListed() != test.listed {
+			t.Errorf("Status '%s' publish at %v listed: %v", test.status, test.publish_at, article.IsListed())
+		}
+		if article.IsVisibleTo(visitor) != test.visible {
+			t.Errorf("Status '%s' publish at %v visible: %v", test.status, test.publish_at, !test.visible)
+		}
+		if !article.IsVisibleTo(admin) {
+			t.Errorf("Status '%s' is not visible to admin", test.status)
+		}
+	}
+}
+
+func TestUnlistedArticlesAreNotListed(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "published", `{"Title": "Published", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	writeTestArticle(t, "draft", `{"Title": "Draft", "DateCreated": "2020-01-02 10:00", "Status": "draft"}`, "Body")
+	writeTestArticle(t, "unlisted", `{"Title": "Unlisted", "DateCreated": "2020-01-03 10:00",
+		"Status": "unlisted"}`, "Body")
+
+	listed := GetAllArticles()
+	if len(listed) != 1 || listed[0].Id != "published" {
+		t.Errorf("%d articles listed", len(listed))
+	}
+
+	for id, code := range map[string]int{"published": 200, "unlisted": 200, "draft": 404} {
+		w := httptest.NewRecorder()
+		articleHandler(w, httptest.NewRequest("GET", "/article/"+id, nil))
+		if w.Code != code {
+			t.Errorf("Status %d for article %s", w.Code, id)
+		}
+	}
+}
@@ -1,28 +1,52 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"regexp"
+	"strings"
 )
 
 type Articles struct {
 	SiteGlobal
+	PageData
 	ArticlesLeft  []*Article
 	ArticlesRight []*Article
 }
 
+var validArticlesPage = regexp.MustCompile("^/articles/page/([0-9]+)$")
+
+func getArticlesPage(r *http.Request) (int, error) {
+	if !strings.HasPrefix(r.URL.Path, "/articles/page/") {
+		// Front page and "/articles/"
+		return 1, nil
+	}
+
+	m := validArticlesPage.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		return 0, errors.New("Invalid page with request: " + r.URL.Path)
+	}
+
+	return parsePageNumber(m[1])
+}
+
 func articlesHandler(w http.ResponseWriter, r *http.Request) {
-	articles_raw := GetAllArticles()
-	articles := Articles{}
-	articles.SiteGlobal = siteGlobal
-
-	// Every other goes to left column, every other to right column
-	for idx, article := range articles_raw {
-		if idx%2 == 0 {
-			articles.ArticlesLeft = append(articles.ArticlesLeft, article)
-		} else {
-			articles.ArticlesRight = append(articles.ArticlesRight, article)
-		}
+	page, err := getArticlesPage(r)
+	if err != nil {
+		http.NotFound(w, r)
+		log.Print("Could not parse page from request:" + err.Error())
+		return
 	}
 
+	articles_page, pagination, err := paginateArticles(GetAllArticles(), page, "/articles/")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	articles := SplitRawArticlesIntoColumns(articles_page)
+	articles.Pagination = pagination
+
 	renderTemplate(w, "articles", articles)
 }
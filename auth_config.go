@@ -25,7 +25,9 @@ var (
 	cookieAuthKey []byte
 	cookieEncrKey []byte
 	secureCookie  *securecookie.SecureCookie
-	cookieName    = "buq2_cookie"
+	// Values which never expire, used in unsubscribe links
+	permanentCookie *securecookie.SecureCookie
+	cookieName      = "buq2_cookie"
 )
 
 func getGoogleOauthClientIdAndSecret() (string, string) {
@@ -50,6 +52,7 @@ func readAuthConfig() error {
 		return err
 	}
 	secureCookie = securecookie.New(cookieAuthKey, cookieEncrKey)
+	permanentCookie = securecookie.New(cookieAuthKey, cookieEncrKey).MaxAge(0)
 	// verify auth/encr keys are correct
 	val := map[string]string{
 		"foo": "bar",
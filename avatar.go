@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	avatarRoute = "/avatar/"
+	// Identicon is a mirrored grid of avatarCells x avatarCells
+	avatarCells    = 5
+	avatarCellSize = 14
+	avatarMargin   = 5
+	// Number of generated images kept in memory
+	avatarCacheSize = 1000
+
+	defaultEmailHashKeyFile = "/email_hash.key"
+)
+
+var (
+	avatarCache      = make(map[string][]byte)
+	avatarCacheMutex sync.Mutex
+
+	// Set by initEmailHashKey
+	emailHashKey []byte
+)
+
+func getEmailHashKeyFile() string {
+	if len(siteGlobal.EmailHashKeyFile) > 0 {
+		return siteGlobal.EmailHashKeyFile
+	}
+	return siteGlobal.ContentRoot + defaultEmailHashKeyFile
+}
+
+// Reads the key of the email hashes, the key is created if the file does
+// not exist. The key must never change, otherwise the stored hashes do not
+// match the addresses anymore.
+func initEmailHashKey() error {
+	filename := getEmailHashKeyFile()
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		key := make([]byte, 32)
+		if _, err = rand.Read(key); err != nil {
+			return err
+		}
+		data = []byte(hex.EncodeToString(key) + "\n")
+		err = ioutil.WriteFile(filename, data, 0600)
+	}
+	if err != nil {
+		return err
+	}
+	emailHashKey, err = hex.DecodeString(strings.TrimSpace(string(data)))
+	return err
+}
+
+// Returns hash of the email, which is stored instead of the address and
+// used in the avatar link. The hash is keyed, such that known addresses
+// can not be looked up from the hashes.
+func hashEmail(email string) string {
+	mac := hmac.New(sha256.New, emailHashKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns hash from which the avatar of the commenter is generated.
+// Commenters without email get the avatar by name, and the site owner
+// always gets the same avatar.
+func (comment Comment) AvatarHash() string {
+	if comment.ByAdmin {
+		return hashEmail(websiteEmail())
+	}
+	if len(comment.EmailHash) > 0 {
+		return comment.EmailHash
+	}
+	hash := sha256.Sum256([]byte("name:" + comment.Name))
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns true if the name is the site owner's, which only admin can
+// use in comments
+func isReservedName(name string) bool {
+	return len(websiteAuthor()) > 0 && strings.EqualFold(strings.TrimSpace(name), websiteAuthor())
+}
+
+// Generates a symmetric identicon from the hash. First bytes select the
+// color and the rest the filled cells.
+func identicon(hash []byte) image.Image {
+	size := 2*avatarMargin + avatarCells*avatarCellSize
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	background := color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+	// Keep the color dark enough to be seen on the background
+	foreground := color.RGBA{hash[0] / 2, hash[1] / 2, hash[2] / 2, 0xff}
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, background)
+		}
+	}
+
+	columns := (avatarCells + 1) / 2
+	for row := 0; row < avatarCells; row++ {
+		for column := 0; column < columns; column++ {
+			bit := row*columns + column
+			if hash[3+bit/8]&(1<<uint(bit%8)) == 0 {
+				continue
+			}
+			// Mirror the left half to the right
+			for _, cell := range []int{column, avatarCells - 1 - column} {
+				x0 := avatarMargin + cell*avatarCellSize
+				y0 := avatarMargin + row*avatarCellSize
+				for y := y0; y < y0+avatarCellSize; y++ {
+					for x := x0; x < x0+avatarCellSize; x++ {
+						img.Set(x, y, foreground)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
+// Returns the avatar as PNG, generated images are cached
+func getAvatar(hash string) ([]byte, error) {
+	avatarCacheMutex.Lock()
+	data, found := avatarCache[hash]
+	avatarCacheMutex.Unlock()
+	if found {
+		return data, nil
+	}
+
+	hash_bytes, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err = png.Encode(&buffer, identicon(hash_bytes)); err != nil {
+		return nil, err
+	}
+	data = buffer.Bytes()
+
+	avatarCacheMutex.Lock()
+	defer avatarCacheMutex.Unlock()
+	if len(avatarCache) >= avatarCacheSize {
+		// Simply start over, the images are cheap to generate
+		avatarCache = make(map[string][]byte)
+	}
+	avatarCache[hash] = data
+	return data, nil
+}
+
+// Serves identicons from '/avatar/<hash>.png'. The image only depends on
+// the hash, so it can be cached forever.
+func avatarHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, avatarRoute)
+	hash := strings.TrimSuffix(name, ".png")
+	if hash == name || len(hash) != 2*sha256.Size {
+		http.NotFound(w, r)
+		log.Print("Invalid avatar: " + name)
+		return
+	}
+
+	data, err := getAvatar(strings.ToLower(hash))
+	if err != nil {
+		http.NotFound(w, r)
+		log.Print("Invalid avatar: " + name)
+		return
+	}
+
+	etag := "\"" + hash + "\""
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cachePolicy(avatarRoute))
+	if notModified(r, etag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data)
+}
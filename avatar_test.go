@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestEmailHashKeyIsStable(t *testing.T) {
+	setupTestContent(t)
+	old_key := emailHashKey
+	defer func() { emailHashKey = old_key }()
+
+	if err := initEmailHashKey(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(getEmailHashKeyFile()); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Key file was not created privately: %v", err)
+	}
+	hash := hashEmail("Reader@Example.com ")
+	first_key := emailHashKey
+
+	// Cookie keys do not affect the hashes
+	setupTestCookies(t)
+	if err := initEmailHashKey(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first_key, emailHashKey) || len(emailHashKey) != 32 {
+		t.Error("Key changed when read again")
+	}
+	if hashEmail("reader@example.com") != hash {
+		t.Error("Hash of the same address changed")
+	}
+	if hashEmail("other@example.com") == hash {
+		t.Error("Different addresses have the same hash")
+	}
+}
+
+func TestEmailHashKeyIsNotServed(t *testing.T) {
+	setupTestContent(t)
+	if !isPrivateContentPath(getEmailHashKeyFile()) {
+		t.Error("Email hash key is public")
+	}
+}
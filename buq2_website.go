@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"runtime"
 )
 
@@ -21,6 +22,13 @@ var templates = template.Must(template.ParseFiles(
 	"templates/article_add_comment.html",
 	"templates/article_comments.html",
 	"templates/article_tags.html",
+	"templates/pagination.html",
+	"templates/search.html",
+	"templates/series.html",
+	"templates/article_series.html",
+	"templates/article_related.html",
+	"templates/admin_comments.html",
+	"templates/comment_edit.html",
 ))
 
 type SiteGlobal struct {
@@ -41,10 +49,141 @@ type SiteGlobal struct {
 	// String which will be added after scripts
 	// Used for additional scripts etc
 	HeadAfterScripts template.HTML;
+
+	// How often content folders are polled for changes if file system
+	// notifications are not available
+	PollIntervalSeconds int
+
+	// Number of articles on each page of article listings
+	ArticlesPerPage int
+
+	// Number of related articles shown below an article
+	NumRelatedArticles int
+
+	// If not empty, 'lint' command reports tags which are not listed
+	KnownTags []string
+
+	// Sitemap is split into an index and parts if there are more URLs
+	SitemapMaxUrls int
+	// Content of robots.txt, link to the sitemap is always added
+	RobotsTxt string
+
+	// If true, feeds contain the whole article instead of the description
+	FeedFullContent bool
+	// Maximum number of articles in a feed
+	FeedMaxItems int
+
+	// Cache-Control values by route, overrides the defaults
+	CachePolicies map[string]string
+	// Hash of the static files, added to their links such that they can
+	// be cached forever
+	StaticVersion string
+
+	// Where comments are stored, "file" (default) or "sqlite"
+	CommentStorage string
+	// SQLite database file, defaults to 'comments.db' in the content root
+	CommentDatabase string
+	// New comments are approved without moderation if the commenter has
+	// an approved comment
+	AutoApproveReturningCommenters bool
+	// Deeper replies are shown at this depth
+	MaxCommentDepth int
+
+	// Captcha of the comment form: "pow", "recaptcha-v2", "recaptcha-v3",
+	// "hcaptcha" or "turnstile". Defaults to "recaptcha-v2" if reCAPTCHA
+	// keys are set, as before, otherwise to "pow".
+	CaptchaProvider string
+	// Keys of the captcha provider, reCAPTCHA keys are used if not set
+	CaptchaSiteKey   string
+	CaptchaSecretKey string
+	// Replaces verification URL of the provider, e.g. with a test server
+	CaptchaVerifyUrl string
+	// Lowest accepted reCAPTCHA v3 score
+	CaptchaMinScore float64
+	// Leading zero bits required from proof-of-work hashes
+	CaptchaPowDifficulty int
+	// HTML of the captcha, set on start
+	CaptchaWidget template.HTML
+
+	// Comments with at least this spam score wait for moderation, and
+	// are rejected with the reject score
+	SpamModerateScore float64
+	SpamRejectScore   float64
+	// Comments sent faster after loading the page are suspicious
+	SpamMinSeconds int
+	// Number of links allowed in a comment
+	SpamMaxLinks int
+	// Words, and addresses or CIDR ranges, which mark comments as spam
+	SpamBannedWords []string
+	SpamBannedIps   []string
+	// File of the spam classifier, defaults to 'spam_model.json' in the
+	// content root
+	SpamModelFile string
+
+	// Comments allowed from an address and to an article, with the number
+	// of comments which can be sent in a quick succession
+	CommentsPerMinutePerIp      float64
+	CommentBurstPerIp           int
+	CommentsPerMinutePerArticle float64
+	CommentBurstPerArticle      int
+	// How long commenters can edit and delete their comments
+	CommentEditMinutes int
+	// Stops accepting new comments and edits on all articles
+	CommentsReadOnly bool
+	// Key of the email hashes, created on first start. Defaults to
+	// 'email_hash.key' in the content root.
+	EmailHashKeyFile string
+
+	// How email is sent: "smtp", "file" (maildir for testing) or empty for
+	// no email
+	Mailer       string
+	SmtpHost     string
+	SmtpPort     int
+	SmtpUsername string
+	SmtpPassword string
+	// Sender of the email, defaults to Email
+	MailFrom string
+	// Maildir of the file mailer, defaults to 'mail' next to the
+	// executable. Content root is public, the folder must not be in it.
+	MailFolder string
+
+	// Addresses or CIDR ranges of reverse proxies. X-Forwarded-For header
+	// is used for the client address only if set by these.
+	TrustedProxies []string
+}
+
+// State of a single rendered page, embedded in the template data next to
+// SiteGlobal
+type PageData struct {
+	// Links to previous and next pages of a listing
+	Pagination Pagination
+
+	// Feeds which apply to the page
+	Feeds []FeedLink
+
+	// Set when rendering static files, parts which need the server
+	// (comments, search) are not shown
+	StaticExport bool
+}
+
+// Returns page data with the site feeds, pages with additional feeds
+// change these
+func newPageData() PageData {
+	return PageData{Feeds: getSiteFeedLinks(), StaticExport: staticExport}
 }
 
 var (
 	siteGlobal = SiteGlobal{}
+
+	// Commands which can be given as the first argument. Server is started
+	// if no command is given.
+	commands = map[string]func(args []string) int{
+		"lint":             lintCommand,
+		"export":           exportCommand,
+		"migrate-comments": migrateCommentsCommand,
+		"import-comments":  importCommentsCommand,
+		"export-comments":  exportCommentsCommand,
+	}
 )
 
 func readGlobalConfig() error {
@@ -63,6 +202,9 @@ func readGlobalConfig() error {
 	if err != nil {
 		return err
 	}
+
+	siteGlobal.StaticVersion = getStaticVersion()
+
 	return err
 }
 
@@ -100,6 +242,53 @@ func main() {
 		return
 	}
 
+	err = initCommentStore()
+	if nil != err {
+		fmt.Println("Failed to open comment storage: " + err.Error())
+		return
+	}
+
+	err = initEmailHashKey()
+	if nil != err {
+		fmt.Println("Failed to load email hash key: " + err.Error())
+		return
+	}
+
+	err = initCaptcha()
+	if nil != err {
+		fmt.Println("Failed to configure captcha: " + err.Error())
+		return
+	}
+
+	err = initTrustedProxies()
+	if nil != err {
+		fmt.Println("Failed to configure trusted proxies: " + err.Error())
+		return
+	}
+
+	err = initSpamFilter()
+	if nil != err {
+		fmt.Println("Failed to configure spam filter: " + err.Error())
+		return
+	}
+
+	initRateLimits()
+
+	err = initMailer()
+	if nil != err {
+		fmt.Println("Failed to configure mailer: " + err.Error())
+		return
+	}
+
+	if len(os.Args) > 1 {
+		command, found := commands[os.Args[1]]
+		if !found {
+			fmt.Println("Unknown command: " + os.Args[1])
+			os.Exit(2)
+		}
+		os.Exit(command(os.Args[2:]))
+	}
+
 	err = readAuthConfig()
 	if nil != err {
 		fmt.Println("Failed to load auth configurations: " + err.Error())
@@ -108,17 +297,43 @@ func main() {
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	http.HandleFunc("/", articlesHandler)
-	http.HandleFunc("/articles/", articlesHandler)
-	http.HandleFunc("/article/", articleHandler)
-	http.HandleFunc("/about/", aboutHandler)
-	http.HandleFunc("/atom.xml", atomHandler)
-	http.HandleFunc("/rss", rssHandler)
-	http.HandleFunc("/tag/", tagHandler)
+	articleStore.Watch()
+	// Comment files are watched with the articles
+	if database, ok := commentStore.(*SqliteCommentStore); ok {
+		database.Watch(articleStore, pollInterval())
+	}
+
+	// Content pages are served with validators and cache headers
+	for route, handler := range map[string]http.HandlerFunc{
+		"/":            articlesHandler,
+		"/articles/":   articlesHandler,
+		"/article/":    articleHandler,
+		"/atom.xml":    atomHandler,
+		"/rss":         rssHandler,
+		"/feed.json":   jsonFeedHandler,
+		"/sitemap.xml": sitemapHandler,
+		"/sitemap/":    sitemapPartHandler,
+		"/robots.txt":  robotsHandler,
+		"/tag/":        tagHandler,
+		"/series/":     seriesHandler,
+		"/search":      searchHandler,
+		"/search.json": searchJsonHandler,
+	} {
+		http.HandleFunc(route, conditional(route, contentLastModified, handler))
+	}
+	http.HandleFunc("/about/", conditional("/about/", aboutLastModified, aboutHandler))
+	http.HandleFunc(avatarRoute, avatarHandler)
+	http.HandleFunc("/comment/preview", commentPreviewHandler)
+	http.HandleFunc("/captcha/challenge", captchaChallengeHandler)
+	http.HandleFunc("/comment/token", formTokenHandler)
+	http.HandleFunc("/comment/edit", commentEditHandler)
+	http.HandleFunc("/comment/moderate", commentModerateHandler)
+	http.HandleFunc("/comment/unsubscribe", commentUnsubscribeHandler)
+	http.HandleFunc("/admin/comments", adminCommentsHandler)
 	http.HandleFunc("/login", loginHandler)
 	http.HandleFunc("/logout", logoutHandler)
 	http.HandleFunc("/oauth2callback", oauth2callbackHandler)
-	http.Handle("/static/", fileserverHandlerStatic())
-	http.Handle("/content_static/", fileserverHandlerContentStatic())
+	http.Handle("/static/", cacheControl("/static/", fileserverHandlerStatic()))
+	http.Handle("/content_static/", cacheControl("/content_static/", fileserverHandlerContentStatic()))
 	http.ListenAndServe(":8080", nil)
 }
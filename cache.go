@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Cache-Control values by route, can be overridden in the site config
+var defaultCachePolicies = map[string]string{
+	// Files under '/static/' are linked with a version parameter
+	"/static/":         "public, max-age=31536000, immutable",
+	"/content_static/": "public, max-age=86400",
+	"/atom.xml":        "public, max-age=900",
+	"/rss":             "public, max-age=900",
+	"/feed.json":       "public, max-age=900",
+	"/sitemap.xml":     "public, max-age=3600",
+	"/sitemap/":        "public, max-age=3600",
+	"/robots.txt":      "public, max-age=86400",
+	// Avatar only depends on the hash in the link
+	"/avatar/": "public, max-age=31536000, immutable",
+}
+
+const (
+	// Pages are always revalidated, which is cheap with the validators
+	defaultCachePolicy = "public, no-cache"
+	// Pages shown to logged in users might contain private data
+	privateCachePolicy = "private, no-cache"
+)
+
+// Buffers the response such that validators can be computed from the body
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (response *bufferedResponse) Header() http.Header {
+	return response.header
+}
+
+func (response *bufferedResponse) Write(data []byte) (int, error) {
+	return response.body.Write(data)
+}
+
+func (response *bufferedResponse) WriteHeader(status int) {
+	response.status = status
+}
+
+func cachePolicy(route string) string {
+	if policy, found := siteGlobal.CachePolicies[route]; found {
+		return policy
+	}
+	if policy, found := defaultCachePolicies[route]; found {
+		return policy
+	}
+	return defaultCachePolicy
+}
+
+// Returns newest modification time of the files, zero time if none exist
+func newestModificationTime(filenames ...string) time.Time {
+	newest := time.Time{}
+	for _, filename := range filenames {
+		info, err := os.Stat(filename)
+		if err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest
+}
+
+// Times when the content changes without the article store changing,
+// publish times of scheduled articles and closing times of comments
+var contentChangeTimes = newListingIndex(func(articles []*Article) interface{} {
+	times := []time.Time{}
+	for _, article := range articles {
+		if article.Status == articleStatusScheduled {
+			times = append(times, article.PublishAt.Time)
+		}
+		if closes := article.CommentsCloseTime(); !closes.IsZero() {
+			times = append(times, closes)
+		}
+	}
+	return times
+})
+
+// Returns time when any article or comment was last changed. Also used
+// for article pages, as series navigation and related articles depend on
+// the other articles.
+func contentLastModified(r *http.Request) time.Time {
+	newest := articleStore.Modified()
+	now := time.Now()
+	for _, changed := range contentChangeTimes.Get().([]time.Time) {
+		if changed.After(newest) && !changed.After(now) {
+			newest = changed
+		}
+	}
+	return newest
+}
+
+func aboutLastModified(r *http.Request) time.Time {
+	return newestModificationTime(siteGlobal.ContentRoot + "/about/about.md")
+}
+
+// Returns true if the client already has the response
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	// If-None-Match has precedence over If-Modified-Since
+	if match := r.Header.Get("If-None-Match"); len(match) > 0 {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// Adds validators and cache headers to the responses of the handler and
+// answers conditional requests with 304. Last modification time of the
+// response is given by 'last_modified'.
+func conditional(route string, last_modified func(r *http.Request) time.Time, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			// Posting a comment etc
+			w.Header().Set("Cache-Control", "no-store")
+			handler(w, r)
+			return
+		}
+
+		response := &bufferedResponse{header: w.Header(), status: http.StatusOK}
+		handler(response, r)
+
+		if response.status != http.StatusOK {
+			w.WriteHeader(response.status)
+			w.Write(response.body.Bytes())
+			return
+		}
+
+		hash := sha1.Sum(response.body.Bytes())
+		etag := "\"" + hex.EncodeToString(hash[:]) + "\""
+		modified := last_modified(r)
+
+		w.Header().Set("ETag", etag)
+		if !modified.IsZero() {
+			w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+		if _, err := r.Cookie(cookieName); err == nil {
+			w.Header().Set("Cache-Control", privateCachePolicy)
+		} else {
+			w.Header().Set("Cache-Control", cachePolicy(route))
+		}
+
+		if notModified(r, etag, modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(response.body.Bytes())
+	}
+}
+
+// Sets Cache-Control of the route. Used for files, which http.FileServer
+// already serves with validators.
+func cacheControl(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", cachePolicy(route))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Returns hash of the files under '/static/', used in links to the files
+// such that they can be cached forever
+func getStaticVersion() string {
+	static_path := executablePath() + "/static/"
+	files, err := ioutil.ReadDir(static_path)
+	if err != nil {
+		return ""
+	}
+
+	hash := sha1.New()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(static_path + file.Name())
+		if err == nil {
+			hash.Write([]byte(file.Name()))
+			hash.Write(data)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContentLastModified(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00",
+		"CloseCommentsAfterDays": 1}`, "Body")
+	writeTestArticle(t, "later", `{"Title": "Later", "DateCreated": "2020-01-02 10:00",
+		"Status": "scheduled", "PublishAt": "2100-01-01 10:00"}`, "Body")
+
+	articleStore.modified = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	closed := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	if modified := contentLastModified(nil); !modified.Equal(closed) {
+		t.Errorf("Last modified %v, expected closing of comments at %v", modified, closed)
+	}
+
+	before := time.Now()
+	articleStore.Invalidate("first")
+	if modified := contentLastModified(nil); modified.Before(before) {
+		t.Errorf("Last modified %v is before the invalidation", modified)
+	}
+}
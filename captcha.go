@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Verifies that the comment form was sent by a human
+type CaptchaVerifier interface {
+	// Returns true if the captcha of the form was solved. The address of
+	// the client is passed to the providers which use it.
+	Verify(r *http.Request, remote_ip string) (bool, error)
+	// HTML added to the comment form
+	Widget() template.HTML
+}
+
+const (
+	captchaProviderPow         = "pow"
+	captchaProviderRecaptchaV2 = "recaptcha-v2"
+	captchaProviderRecaptchaV3 = "recaptcha-v3"
+	captchaProviderHcaptcha    = "hcaptcha"
+	captchaProviderTurnstile   = "turnstile"
+
+	defaultCaptchaMinScore = 0.5
+	captchaTimeout         = 10 * time.Second
+	// reCAPTCHA v3 action of the comment form
+	captchaAction = "comment"
+)
+
+var captchaVerifier CaptchaVerifier
+
+// Verifies captchas with the siteverify protocol, which is shared by
+// reCAPTCHA, hCaptcha and Turnstile
+type SiteverifyCaptcha struct {
+	VerifyUrl string
+	SiteKey   string
+	SecretKey string
+	// Name of the form field which contains the response token
+	ResponseField string
+	// reCAPTCHA v3 returns a score and an action, ignored if zero
+	MinScore float64
+
+	widget *template.Template
+	client *http.Client
+}
+
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      float64  `json:"score"`
+	Action     string   `json:"action"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+var recaptchaV2Widget = template.Must(template.New("").Parse(`
+<script src="https://www.google.com/recaptcha/api.js" async defer></script>
+<div class="g-recaptcha" data-sitekey="{{.SiteKey}}"></div>
+`))
+
+// Token is requested when the form is sent, as it expires in two minutes
+var recaptchaV3Widget = template.Must(template.New("").Parse(`
+<input type="hidden" name="g-recaptcha-response" value="">
+<script src="https://www.google.com/recaptcha/api.js?render={{.SiteKey}}"></script>
+<script>
+    $(document).ready(function() {
+        $("form[name=comment]").on("submit", function(event) {
+            var form = this;
+            event.preventDefault();
+            grecaptcha.ready(function() {
+                grecaptcha.execute({{.SiteKey}}, {action: {{.Action}}}).then(function(token) {
+                    form.elements["g-recaptcha-response"].value = token;
+                    form.submit();
+                });
+            });
+        });
+    });
+</script>
+`))
+
+var hcaptchaWidget = template.Must(template.New("").Parse(`
+<script src="https://js.hcaptcha.com/1/api.js" async defer></script>
+<div class="h-captcha" data-sitekey="{{.SiteKey}}"></div>
+`))
+
+var turnstileWidget = template.Must(template.New("").Parse(`
+<script src="https://challenges.cloudflare.com/turnstile/v0/api.js" async defer></script>
+<div class="cf-turnstile" data-sitekey="{{.SiteKey}}"></div>
+`))
+
+func newSiteverifyCaptcha(verify_url string, response_field string, widget *template.Template) *SiteverifyCaptcha {
+	captcha := new(SiteverifyCaptcha)
+	captcha.VerifyUrl = verify_url
+	captcha.ResponseField = response_field
+	captcha.widget = widget
+	captcha.client = &http.Client{Timeout: captchaTimeout}
+	return captcha
+}
+
+func NewRecaptchaV2(site_key string, secret_key string) *SiteverifyCaptcha {
+	captcha := newSiteverifyCaptcha("https://www.google.com/recaptcha/api/siteverify",
+		"g-recaptcha-response", recaptchaV2Widget)
+	captcha.SiteKey = site_key
+	captcha.SecretKey = secret_key
+	return captcha
+}
+
+func NewRecaptchaV3(site_key string, secret_key string, min_score float64) *SiteverifyCaptcha {
+	captcha := newSiteverifyCaptcha("https://www.google.com/recaptcha/api/siteverify",
+		"g-recaptcha-response", recaptchaV3Widget)
+	captcha.SiteKey = site_key
+	captcha.SecretKey = secret_key
+	captcha.MinScore = min_score
+	return captcha
+}
+
+func NewHcaptcha(site_key string, secret_key string) *SiteverifyCaptcha {
+	captcha := newSiteverifyCaptcha("https://api.hcaptcha.com/siteverify",
+		"h-captcha-response", hcaptchaWidget)
+	captcha.SiteKey = site_key
+	captcha.SecretKey = secret_key
+	return captcha
+}
+
+func NewTurnstile(site_key string, secret_key string) *SiteverifyCaptcha {
+	captcha := newSiteverifyCaptcha("https://challenges.cloudflare.com/turnstile/v0/siteverify",
+		"cf-turnstile-response", turnstileWidget)
+	captcha.SiteKey = site_key
+	captcha.SecretKey = secret_key
+	return captcha
+}
+
+func (captcha *SiteverifyCaptcha) Verify(r *http.Request, remote_ip string) (bool, error) {
+	token := r.FormValue(captcha.ResponseField)
+	if len(token) == 0 {
+		return false, nil
+	}
+
+	form := url.Values{}
+	form.Set("secret", captcha.SecretKey)
+	form.Set("response", token)
+	form.Set("remoteip", remote_ip)
+	response, err := captcha.client.PostForm(captcha.VerifyUrl, form)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, errors.New("Captcha verification failed with status: " + response.Status)
+	}
+
+	result := siteverifyResponse{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return false, err
+	}
+	if !result.Success {
+		return false, nil
+	}
+	if captcha.MinScore > 0 {
+		return result.Score >= captcha.MinScore && result.Action == captchaAction, nil
+	}
+	return true, nil
+}
+
+func (captcha *SiteverifyCaptcha) Widget() template.HTML {
+	var html bytes.Buffer
+	err := captcha.widget.Execute(&html, struct {
+		SiteKey string
+		Action  string
+	}{captcha.SiteKey, captchaAction})
+	if err != nil {
+		return ""
+	}
+	return template.HTML(html.String())
+}
+
+// Returns the captcha provider of the site config. Sites configured with
+// only the reCAPTCHA keys keep using reCAPTCHA.
+func captchaProvider() string {
+	if len(siteGlobal.CaptchaProvider) > 0 {
+		return siteGlobal.CaptchaProvider
+	}
+	if len(siteGlobal.RecaptchaPublicKey) > 0 && len(siteGlobal.RecaptchaPrivateKey) > 0 {
+		return captchaProviderRecaptchaV2
+	}
+	return captchaProviderPow
+}
+
+// Creates the captcha verifier selected in the site config
+func initCaptcha() error {
+	site_key := siteGlobal.CaptchaSiteKey
+	secret_key := siteGlobal.CaptchaSecretKey
+	if len(site_key) == 0 && len(secret_key) == 0 {
+		site_key = siteGlobal.RecaptchaPublicKey
+		secret_key = siteGlobal.RecaptchaPrivateKey
+	}
+	min_score := siteGlobal.CaptchaMinScore
+	if min_score <= 0 {
+		min_score = defaultCaptchaMinScore
+	}
+
+	var siteverify *SiteverifyCaptcha
+	provider := captchaProvider()
+	switch provider {
+	case captchaProviderPow:
+		captchaVerifier = NewPowCaptcha(siteGlobal.CaptchaPowDifficulty)
+	case captchaProviderRecaptchaV2:
+		siteverify = NewRecaptchaV2(site_key, secret_key)
+	case captchaProviderRecaptchaV3:
+		siteverify = NewRecaptchaV3(site_key, secret_key, min_score)
+	case captchaProviderHcaptcha:
+		siteverify = NewHcaptcha(site_key, secret_key)
+	case captchaProviderTurnstile:
+		siteverify = NewTurnstile(site_key, secret_key)
+	default:
+		return errors.New("Unknown captcha provider: " + provider)
+	}
+
+	if siteverify != nil {
+		if len(siteGlobal.CaptchaVerifyUrl) > 0 {
+			siteverify.VerifyUrl = siteGlobal.CaptchaVerifyUrl
+		}
+		captchaVerifier = siteverify
+	}
+
+	siteGlobal.CaptchaWidget = captchaVerifier.Widget()
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"math/bits"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of leading zero bits, each bit doubles the work
+	defaultPowDifficulty = 16
+	// Challenge must be solved and sent within this time
+	powChallengeMaxAge = time.Hour
+
+	powTokenName = "buq2_pow"
+)
+
+// Proof-of-work captcha which does not need any third-party service. The
+// browser must find a nonce such that SHA-256 of the challenge token and
+// the nonce starts with the required number of zero bits. Challenge tokens
+// are signed such that they can not be forged, and can be used only once.
+type PowCaptcha struct {
+	Difficulty int
+
+	// Tokens which have been used, with their expiration times
+	mutex sync.Mutex
+	used  map[string]time.Time
+}
+
+// Content of the challenge token
+type PowChallenge struct {
+	Random     string
+	Difficulty int
+	Issued     int64
+}
+
+// Challenge sent to the browser
+type powChallengeJson struct {
+	Token      string
+	Difficulty int
+}
+
+var powWidget = template.HTML(`
+<input type="hidden" name="pow_token" value="">
+<input type="hidden" name="pow_nonce" value="">
+<div id="pow-status"></div>
+<script>
+    function PowLeadingZeroBits(digest) {
+        var zeros = 0;
+        for (var idx = 0; idx < digest.length; idx++) {
+            if (digest[idx] == 0) {
+                zeros += 8;
+                continue;
+            }
+            return zeros + Math.clz32(digest[idx]) - 24;
+        }
+        return zeros;
+    }
+
+    async function SolvePowChallenge() {
+        var form = document.forms["comment"];
+        $("#pow-status").text("Checking that you are not a robot...");
+        var response = await fetch("/captcha/challenge", {cache: "no-store"});
+        var challenge = await response.json();
+        var encoder = new TextEncoder();
+        for (var nonce = 0; ; nonce++) {
+            var data = encoder.encode(challenge.Token + ":" + nonce);
+            var digest = new Uint8Array(await crypto.subtle.digest("SHA-256", data));
+            if (PowLeadingZeroBits(digest) >= challenge.Difficulty) {
+                form.elements["pow_token"].value = challenge.Token;
+                form.elements["pow_nonce"].value = nonce;
+                $("#pow-status").text("");
+                return;
+            }
+        }
+    }
+
+    // Only commenters need to do the work
+    $(document).ready(function() {
+        $("textarea[name=comment]").one("focus", SolvePowChallenge);
+    });
+</script>
+`)
+
+func NewPowCaptcha(difficulty int) *PowCaptcha {
+	captcha := new(PowCaptcha)
+	captcha.Difficulty = difficulty
+	if captcha.Difficulty <= 0 {
+		captcha.Difficulty = defaultPowDifficulty
+	}
+	captcha.used = make(map[string]time.Time)
+	return captcha
+}
+
+// Returns new signed challenge token
+func (captcha *PowCaptcha) NewChallenge() (string, error) {
+	challenge := PowChallenge{
+		Random:     newCommentId(),
+		Difficulty: captcha.Difficulty,
+		Issued:     time.Now().Unix(),
+	}
+	return secureCookie.Encode(powTokenName, challenge)
+}
+
+// Marks the token used, returns false if it already was
+func (captcha *PowCaptcha) markUsed(token string) bool {
+	captcha.mutex.Lock()
+	defer captcha.mutex.Unlock()
+
+	now := time.Now()
+	for used, expires := range captcha.used {
+		if now.After(expires) {
+			delete(captcha.used, used)
+		}
+	}
+
+	if _, found := captcha.used[token]; found {
+		return false
+	}
+	captcha.used[token] = now.Add(powChallengeMaxAge)
+	return true
+}
+
+func powLeadingZeroBits(digest []byte) int {
+	zeros := 0
+	for _, b := range digest {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+func (captcha *PowCaptcha) Verify(r *http.Request, remote_ip string) (bool, error) {
+	token := r.FormValue("pow_token")
+	nonce := r.FormValue("pow_nonce")
+	if len(token) == 0 || len(nonce) == 0 {
+		return false, nil
+	}
+
+	challenge := PowChallenge{}
+	err := secureCookie.Decode(powTokenName, token, &challenge)
+	if err != nil {
+		return false, errors.New("Invalid proof-of-work token: " + err.Error())
+	}
+	if time.Since(time.Unix(challenge.Issued, 0)) > powChallengeMaxAge {
+		return false, nil
+	}
+
+	digest := sha256.Sum256([]byte(token + ":" + nonce))
+	if powLeadingZeroBits(digest[:]) < challenge.Difficulty {
+		return false, nil
+	}
+
+	// Checked last, such that invalid solutions do not use the token
+	return captcha.markUsed(token), nil
+}
+
+func (captcha *PowCaptcha) Widget() template.HTML {
+	return powWidget
+}
+
+// Returns new proof-of-work challenge as JSON
+func captchaChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	captcha, ok := captchaVerifier.(*PowCaptcha)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	token, err := captcha.NewChallenge()
+	if err != nil {
+		log.Print("Failed to create proof-of-work challenge: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(powChallengeJson{token, captcha.Difficulty})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(bytes)
+}
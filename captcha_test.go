@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Starts a siteverify server which accepts the token "valid" with the
+// secret "secret" and answers with the given score and action
+func newSiteverifyStub(t *testing.T, score float64, action string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Siteverify called with %s", r.Method)
+		}
+		if r.FormValue("remoteip") != "192.0.2.1" {
+			t.Errorf("Remote address '%s' was sent", r.FormValue("remoteip"))
+		}
+		response := siteverifyResponse{Score: score, Action: action}
+		response.Success = r.FormValue("secret") == "secret" && r.FormValue("response") == "valid"
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setupCaptcha(t *testing.T, provider string, verify_url string) {
+	t.Helper()
+	old_global := siteGlobal
+	old_verifier := captchaVerifier
+	t.Cleanup(func() {
+		siteGlobal = old_global
+		captchaVerifier = old_verifier
+	})
+	siteGlobal = SiteGlobal{}
+	siteGlobal.CaptchaProvider = provider
+	siteGlobal.CaptchaSiteKey = "site"
+	siteGlobal.CaptchaSecretKey = "secret"
+	siteGlobal.CaptchaVerifyUrl = verify_url
+	if err := initCaptcha(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func captchaRequest(field string, token string) *http.Request {
+	form := url.Values{}
+	form.Set(field, token)
+	r := httptest.NewRequest("POST", "/article/first", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestSiteverifyCaptchaProviders(t *testing.T) {
+	fields := map[string]string{
+		captchaProviderRecaptchaV2: "g-recaptcha-response",
+		captchaProviderHcaptcha:    "h-captcha-response",
+		captchaProviderTurnstile:   "cf-turnstile-response",
+	}
+	for provider, field := range fields {
+		server := newSiteverifyStub(t, 0, "")
+		setupCaptcha(t, provider, server.URL)
+
+		if !strings.Contains(string(siteGlobal.CaptchaWidget), `data-sitekey="site"`) {
+			t.Errorf("%s: widget without site key: %s", provider, siteGlobal.CaptchaWidget)
+		}
+		if ok, err := captchaVerifier.Verify(captchaRequest(field, "valid"), "192.0.2.1"); !ok || err != nil {
+			t.Errorf("%s: valid token was not accepted: %v", provider, err)
+		}
+		if ok, _ := captchaVerifier.Verify(captchaRequest(field, "invalid"), "192.0.2.1"); ok {
+			t.Errorf("%s: invalid token was accepted", provider)
+		}
+		if ok, _ := captchaVerifier.Verify(captchaRequest(field, ""), "192.0.2.1"); ok {
+			t.Errorf("%s: missing token was accepted", provider)
+		}
+	}
+}
+
+func TestRecaptchaV3Score(t *testing.T) {
+	tests := []struct {
+		score    float64
+		action   string
+		accepted bool
+	}{
+		{0.9, captchaAction, true},
+		{0.1, captchaAction, false},
+		{0.9, "login", false},
+	}
+	for _, test := range tests {
+		server := newSiteverifyStub(t, test.score, test.action)
+		setupCaptcha(t, captchaProviderRecaptchaV3, server.URL)
+
+		ok, err := captchaVerifier.Verify(captchaRequest("g-recaptcha-response", "valid"), "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.accepted {
+			t.Errorf("Score %v with action '%s' accepted: %v", test.score, test.action, ok)
+		}
+	}
+}
+
+func TestSiteverifyCaptchaServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	setupCaptcha(t, captchaProviderHcaptcha, server.URL)
+
+	ok, err := captchaVerifier.Verify(captchaRequest("h-captcha-response", "valid"), "192.0.2.1")
+	if ok || err == nil {
+		t.Error("Failed verification was not reported")
+	}
+}
+
+func TestCaptchaProviderDefault(t *testing.T) {
+	old_global := siteGlobal
+	defer func() { siteGlobal = old_global }()
+
+	siteGlobal = SiteGlobal{}
+	if provider := captchaProvider(); provider != captchaProviderPow {
+		t.Errorf("Default provider without keys is '%s'", provider)
+	}
+	siteGlobal.RecaptchaPublicKey = "public"
+	siteGlobal.RecaptchaPrivateKey = "private"
+	if provider := captchaProvider(); provider != captchaProviderRecaptchaV2 {
+		t.Errorf("Default provider with reCAPTCHA keys is '%s'", provider)
+	}
+	siteGlobal.CaptchaProvider = captchaProviderTurnstile
+	if provider := captchaProvider(); provider != captchaProviderTurnstile {
+		t.Errorf("Configured provider was replaced with '%s'", provider)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Networks of the reverse proxies, parsed from SiteGlobal.TrustedProxies
+var trustedProxyNets []*net.IPNet
+
+// Parses the trusted proxies of the site config
+func initTrustedProxies() error {
+	networks, err := parseNetworks(siteGlobal.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	trustedProxyNets = networks
+	return nil
+}
+
+// Parses addresses and CIDR ranges
+func parseNetworks(addresses []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, address := range addresses {
+		if !strings.Contains(address, "/") {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, errors.New("Invalid address: " + address)
+			}
+			if ip.To4() != nil {
+				address += "/32"
+			} else {
+				address += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, errors.New("Invalid address range: " + address)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxyNets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns address of the client. X-Forwarded-For is only used if the
+// request comes from a trusted proxy, and then the last address which is
+// not a trusted proxy is the client.
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip) {
+		return host
+	}
+
+	// Proxies append to the header, so the rightmost addresses are the
+	// most trustworthy
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for idx := len(forwarded) - 1; idx >= 0; idx-- {
+		forwarded_ip := net.ParseIP(strings.TrimSpace(forwarded[idx]))
+		if forwarded_ip == nil {
+			// Can not trust anything before an invalid address
+			break
+		}
+		host = forwarded_ip.String()
+		if !isTrustedProxy(forwarded_ip) {
+			break
+		}
+	}
+	return host
+}
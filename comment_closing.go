@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// Returns time when comments of the article close by age, zero time if
+// they do not
+func (article Article) CommentsCloseTime() time.Time {
+	if article.CloseCommentsAfterDays <= 0 || article.DateCreated.IsZero() {
+		return time.Time{}
+	}
+	return article.DateCreated.AddDate(0, 0, article.CloseCommentsAfterDays)
+}
+
+// Returns why new comments are not accepted to the article, empty if
+// commenting is open
+func (article Article) CommentsClosedReason() string {
+	if siteGlobal.CommentsReadOnly {
+		return "Commenting is disabled on the whole site for now"
+	}
+	if article.CommentsClosed {
+		return "Comments are closed for this article"
+	}
+	closes := article.CommentsCloseTime()
+	if !closes.IsZero() && !time.Now().Before(closes) {
+		return "Comments are closed, the article is older than " +
+			strconv.Itoa(article.CloseCommentsAfterDays) + " days"
+	}
+	return ""
+}
+
+func (article Article) AreCommentsClosed() bool {
+	return len(article.CommentsClosedReason()) > 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommentsClosedReason(t *testing.T) {
+	old := siteGlobal
+	defer func() { siteGlobal = old }()
+
+	recent := ParsableTime{time.Now().Add(-24 * time.Hour)}
+	old_date := ParsableTime{time.Now().Add(-40 * 24 * time.Hour)}
+	tests := []struct {
+		article   Article
+		read_only bool
+		closed    bool
+	}{
+		{Article{DateCreated: old_date}, false, false},
+		{Article{DateCreated: recent, CommentsClosed: true}, false, true},
+		{Article{DateCreated: recent, CloseCommentsAfterDays: 30}, false, false},
+		{Article{DateCreated: old_date, CloseCommentsAfterDays: 30}, false, true},
+		// Closing by age needs the creation date
+		{Article{CloseCommentsAfterDays: 30}, false, false},
+		{Article{DateCreated: recent}, true, true},
+	}
+	for idx, test := range tests {
+		siteGlobal.CommentsReadOnly = test.read_only
+		if closed := test.article.AreCommentsClosed(); closed != test.closed {
+			t.Errorf("Test %d: comments closed %v, reason '%s'", idx, closed, test.article.CommentsClosedReason())
+		}
+	}
+
+	article := Article{DateCreated: recent, CloseCommentsAfterDays: 30}
+	if closes := article.CommentsCloseTime(); !closes.Equal(recent.AddDate(0, 0, 30)) {
+		t.Errorf("Comments close at %v", closes)
+	}
+}
+
+func TestCommentToClosedArticleIsRefused(t *testing.T) {
+	setupTestContent(t)
+	setupTestCookies(t)
+	old_ip, old_article := commentIpLimiter, commentArticleLimiter
+	defer func() { commentIpLimiter, commentArticleLimiter = old_ip, old_article }()
+	initRateLimits()
+	writeTestArticle(t, "open", `{"Title": "Open", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	writeTestArticle(t, "closed", `{"Title": "Closed", "DateCreated": "2020-01-01 10:00",
+		"CommentsClosed": true}`, "Body")
+
+	post := func(id string) *httptest.ResponseRecorder {
+		form := url.Values{"user": {"Reader"}, "comment": {"Hello"}}
+		r := httptest.NewRequest("POST", "/article/"+id, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		articleHandler(w, r)
+		return w
+	}
+
+	if w := post("closed"); w.Code != http.StatusForbidden {
+		t.Errorf("Status %d for comment to a closed article", w.Code)
+	}
+	if count, _ := commentStore.Count("closed"); count != 0 {
+		t.Error("Comment to a closed article was stored")
+	}
+
+	siteGlobal.CommentsReadOnly = true
+	if w := post("open"); w.Code != http.StatusForbidden {
+		t.Errorf("Status %d for comment to a read only site", w.Code)
+	}
+	if count, _ := commentStore.Count("open"); count != 0 {
+		t.Error("Comment to a read only site was stored")
+	}
+}
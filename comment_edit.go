@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	editTokenName = "buq2_edit"
+
+	defaultCommentEditMinutes = 15
+)
+
+// Earlier version of an edited comment, kept for the admin
+type CommentRevision struct {
+	CommentBody string
+	// When the revision was replaced by an edit
+	Replaced ParsableTime
+}
+
+// Given to the commenter when the comment is added, allows editing and
+// deleting the comment until the edit window closes
+type editToken struct {
+	ArticleId string
+	CommentId string
+	Issued    time.Time
+}
+
+type CommentEditData struct {
+	SiteGlobal
+	PageData
+	Comment     Comment
+	ArticleLink string
+	Token       string
+	// Signed time of loading the form, see TimeOnPageRule
+	FormToken string
+	// Comment can be edited until
+	Deadline ParsableTime
+	Saved    bool
+	Deleted  bool
+	// Edited comment waits for moderation
+	Pending bool
+	// Comments of the article are closed, see CommentsClosedReason
+	ClosedReason string
+}
+
+func commentEditWindow() time.Duration {
+	minutes := siteGlobal.CommentEditMinutes
+	if minutes <= 0 {
+		minutes = defaultCommentEditMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Returns token for editing the comment, empty if it could not be created
+func newEditToken(article_id string, comment_id string) string {
+	token, err := secureCookie.Encode(editTokenName, editToken{article_id, comment_id, time.Now()})
+	if err != nil {
+		log.Print("Failed to create edit token: " + err.Error())
+		return ""
+	}
+	return token
+}
+
+func decodeEditToken(token_string string) (editToken, error) {
+	token := editToken{}
+	err := secureCookie.Decode(editTokenName, token_string, &token)
+	if err != nil {
+		return token, err
+	}
+	if time.Since(token.Issued) > commentEditWindow() {
+		return token, errors.New("Edit token has expired")
+	}
+	return token, nil
+}
+
+// Returns true if the commenter has changed the comment
+func (comment Comment) IsEdited() bool {
+	return comment.Edited != nil
+}
+
+// Returns the comment unless the commenter has deleted it or it has been
+// rejected. Rejected comments can not be changed, an edit would send them
+// back to moderation.
+func findOwnComment(article_id string, comment_id string) (Comment, error) {
+	comment, err := findComment(article_id, comment_id)
+	if err == nil && (comment.Status == commentStatusDeleted || comment.Status == commentStatusRejected) {
+		return Comment{}, ErrCommentNotFound
+	}
+	return comment, err
+}
+
+// Hides the comment deleted by the commenter. The comment and its
+// revisions are kept for the admin.
+func deleteOwnComment(article_id string, comment_id string) error {
+	comment, err := findOwnComment(article_id, comment_id)
+	if err != nil {
+		return err
+	}
+	comment.Status = commentStatusDeleted
+	// Replies are not sent for deleted comments
+	comment.Email = ""
+	comment.NotifyReplies = false
+	return commentStore.Update(article_id, comment)
+}
+
+// Replaces body of the comment, the old body is kept as a revision. The
+// new body is checked like a new comment, and an approved comment goes
+// back to moderation unless the commenter's comments are approved
+// automatically.
+func editComment(article_id string, comment_id string, body string, r *http.Request) (Comment, error) {
+	if len(strings.TrimSpace(body)) == 0 {
+		return Comment{}, errors.New("Comment can not be empty")
+	}
+	comment, err := findOwnComment(article_id, comment_id)
+	if err != nil {
+		return comment, err
+	}
+	if body == comment.CommentBody {
+		return comment, nil
+	}
+
+	now := ParsableTime{time.Now()}
+	comment.Revisions = append(comment.Revisions, CommentRevision{comment.CommentBody, now})
+	comment.CommentBody = body
+	comment.Edited = &now
+	if !comment.ByAdmin {
+		if comment.IsApproved() {
+			comment.Status = newCommentStatus(comment.CommenterId)
+		}
+		applySpamResult(&comment, checkSpam(r, comment))
+	}
+	return comment, commentStore.Update(article_id, comment)
+}
+
+// Shows the edit form of the comment with the token, and saves or deletes
+// the comment when the form is posted
+func commentEditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	token_string := r.FormValue("token")
+	token, err := decodeEditToken(token_string)
+	if err != nil {
+		http.NotFound(w, r)
+		log.Print("Invalid edit token: " + err.Error())
+		return
+	}
+
+	article, err := articleStore.Get(token.ArticleId)
+	if article == nil {
+		http.NotFound(w, r)
+		log.Print("Article of the edited comment not found: " + err.Error())
+		return
+	}
+
+	data := CommentEditData{}
+	data.SiteGlobal = siteGlobal
+	data.PageData = newPageData()
+	data.Title = "Edit comment"
+	data.ArticleLink = "/article/" + token.ArticleId
+	data.Token = token_string
+	data.Deadline = ParsableTime{token.Issued.Add(commentEditWindow())}
+	data.ClosedReason = article.CommentsClosedReason()
+	// Edit page is not cached, the token can be added here
+	data.FormToken, err = newFormToken()
+	if err != nil {
+		log.Print("Failed to create form token: " + err.Error())
+	}
+
+	if r.Method == "POST" {
+		if len(data.ClosedReason) > 0 {
+			http.Error(w, data.ClosedReason, http.StatusForbidden)
+			return
+		}
+		switch r.FormValue("action") {
+		case "delete":
+			err = deleteOwnComment(token.ArticleId, token.CommentId)
+			data.Deleted = true
+		default:
+			data.Comment, err = editComment(token.ArticleId, token.CommentId, r.FormValue("comment"), r)
+			data.Saved = true
+			data.Pending = data.Comment.Status == commentStatusPending
+		}
+		if err != nil {
+			log.Print("Failed to edit comment: " + err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		articleStore.Invalidate(token.ArticleId)
+	} else {
+		data.Comment, err = findOwnComment(token.ArticleId, token.CommentId)
+		if err != nil {
+			http.NotFound(w, r)
+			log.Print("Comment to edit not found: " + err.Error())
+			return
+		}
+	}
+
+	renderTemplate(w, "comment_edit", data)
+}
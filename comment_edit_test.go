@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditToken(t *testing.T) {
+	setupTestCookies(t)
+	siteGlobal.CommentEditMinutes = 15
+
+	token, err := decodeEditToken(newEditToken("first", "abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ArticleId != "first" || token.CommentId != "abc" {
+		t.Errorf("Token is for %s/%s", token.ArticleId, token.CommentId)
+	}
+
+	expired, _ := secureCookie.Encode(editTokenName, editToken{"first", "abc", time.Now().Add(-16 * time.Minute)})
+	if _, err = decodeEditToken(expired); err == nil {
+		t.Error("Expired token was accepted")
+	}
+	if _, err = decodeEditToken("forged"); err == nil {
+		t.Error("Forged token was accepted")
+	}
+}
+
+func TestEditCommentIsModeratedAgain(t *testing.T) {
+	setupTestContent(t)
+	setupTestCookies(t)
+
+	tests := []struct {
+		auto_approve bool
+		body         string
+		status       string
+	}{
+		{false, "Fixed a typo", commentStatusPending},
+		{true, "Fixed a typo", commentStatusApproved},
+		{true, "Buy http://a.example http://b.example http://c.example", commentStatusPending},
+	}
+	for _, test := range tests {
+		siteGlobal.AutoApproveReturningCommenters = test.auto_approve
+		comment, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Hello",
+			TimeStamp: ParsableTime{time.Now()}, Status: commentStatusApproved, CommenterId: "reader"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		form_token, _ := secureCookie.Encode(formTokenName, time.Now().Add(-time.Minute).UnixNano())
+		form := url.Values{"comment": {test.body}, "form_token": {form_token}}
+		r := httptest.NewRequest("POST", "/comment/edit", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		edited, err := editComment("first", comment.Id, test.body, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if edited.Status != test.status {
+			t.Errorf("Edit to '%s' with auto approve %v is %s", test.body, test.auto_approve, edited.Status)
+		}
+		if len(edited.Revisions) != 1 || edited.Revisions[0].CommentBody != "Hello" {
+			t.Errorf("Revisions %v", edited.Revisions)
+		}
+	}
+}
+
+func TestCommenterDeleteKeepsComment(t *testing.T) {
+	setupTestContent(t)
+	setupTestCookies(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	comment, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Hello",
+		TimeStamp: ParsableTime{time.Now()}, Status: commentStatusApproved,
+		Email: "reader@example.com", NotifyReplies: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := newEditToken("first", comment.Id)
+
+	form := url.Values{"token": {token}, "action": {"delete"}}
+	r := httptest.NewRequest("POST", "/comment/edit", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	commentEditHandler(w, r)
+	if w.Code != 200 {
+		t.Fatalf("Delete returned %d: %s", w.Code, w.Body.String())
+	}
+
+	stored, err := findComment("first", comment.Id)
+	if err != nil {
+		t.Fatal("Deleted comment was removed from the storage")
+	}
+	if stored.Status != commentStatusDeleted || stored.CommentBody != "Hello" || stored.NotifyReplies {
+		t.Errorf("Deleted comment was stored as %+v", stored)
+	}
+	if shown, _ := GetComments("first"); len(*shown) != 0 {
+		t.Error("Deleted comment is shown")
+	}
+	if _, err = editComment("first", comment.Id, "Back", r); err == nil {
+		t.Error("Deleted comment was edited")
+	}
+}
+
+func TestEditOnClosedArticleIsRefused(t *testing.T) {
+	setupTestContent(t)
+	setupTestCookies(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00",
+		"CommentsClosed": true}`, "Body")
+	comment, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Hello",
+		TimeStamp: ParsableTime{time.Now()}, Status: commentStatusApproved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := newEditToken("first", comment.Id)
+
+	for _, action := range []string{"save", "delete"} {
+		form := url.Values{"token": {token}, "action": {action}, "comment": {"Changed"}}
+		r := httptest.NewRequest("POST", "/comment/edit", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		commentEditHandler(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Action %s on a closed article returned %d", action, w.Code)
+		}
+	}
+	stored, err := findComment("first", comment.Id)
+	if err != nil || stored.CommentBody != "Hello" || stored.Status != commentStatusApproved {
+		t.Errorf("Comment on a closed article was changed to %+v", stored)
+	}
+
+	w := httptest.NewRecorder()
+	commentEditHandler(w, httptest.NewRequest("GET", "/comment/edit?token="+url.QueryEscape(token), nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "<form name=\"edit\"") {
+		t.Errorf("Edit form was shown for a closed article, status %d", w.Code)
+	}
+}
+
+func TestRejectedCommentCanNotBeEdited(t *testing.T) {
+	setupTestContent(t)
+	setupTestCookies(t)
+	comment, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Buy things",
+		TimeStamp: ParsableTime{time.Now()}, Status: commentStatusRejected})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/comment/edit", nil)
+	if _, err = editComment("first", comment.Id, "Nice post", r); err == nil {
+		t.Error("Rejected comment was edited")
+	}
+	if err = deleteOwnComment("first", comment.Id); err == nil {
+		t.Error("Rejected comment was deleted")
+	}
+	stored, _ := findComment("first", comment.Id)
+	if stored.Status != commentStatusRejected || stored.CommentBody != "Buy things" {
+		t.Errorf("Rejected comment was changed to %+v", stored)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	exportFormatJson = "json"
+	exportFormatWxr  = "wxr"
+
+	wxrNamespace = "http://wordpress.org/export/1.2/"
+)
+
+// Comments of an article in the JSON export
+type ArticleComments struct {
+	ArticleId string
+	Comments  []Comment
+}
+
+type CommentExport struct {
+	Exported ParsableTime
+	Articles []ArticleComments
+}
+
+// WXR document written by the export. Unlike when reading, the 'wp'
+// prefix is written as part of the element names, as WordPress expects
+// the prefix.
+type wxrOutput struct {
+	XMLName     xml.Name         `xml:"rss"`
+	Version     string           `xml:"version,attr"`
+	WpNamespace string           `xml:"xmlns:wp,attr"`
+	Channel     wxrOutputChannel `xml:"channel"`
+}
+
+type wxrOutputChannel struct {
+	Title      string          `xml:"title"`
+	Link       string          `xml:"link"`
+	WxrVersion string          `xml:"wp:wxr_version"`
+	Items      []wxrOutputItem `xml:"item"`
+}
+
+type wxrOutputItem struct {
+	Title    string             `xml:"title"`
+	Link     string             `xml:"link"`
+	PostName string             `xml:"wp:post_name"`
+	PostType string             `xml:"wp:post_type"`
+	Status   string             `xml:"wp:status"`
+	Comments []wxrOutputComment `xml:"wp:comment"`
+}
+
+type wxrOutputComment struct {
+	Id       int    `xml:"wp:comment_id"`
+	Author   string `xml:"wp:comment_author"`
+	Email    string `xml:"wp:comment_author_email"`
+	Date     string `xml:"wp:comment_date"`
+	DateGmt  string `xml:"wp:comment_date_gmt"`
+	Content  string `xml:"wp:comment_content"`
+	Approved string `xml:"wp:comment_approved"`
+	Type     string `xml:"wp:comment_type"`
+	Parent   int    `xml:"wp:comment_parent"`
+}
+
+// Returns all comments of all articles, including comments which are not
+// approved
+func getAllArticleComments(store CommentStore) ([]ArticleComments, error) {
+	article_ids, err := store.ArticleIds()
+	if err != nil {
+		return nil, err
+	}
+
+	articles := []ArticleComments{}
+	for _, article_id := range article_ids {
+		comments, err := store.List(article_id)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, ArticleComments{article_id, comments})
+	}
+	return articles, nil
+}
+
+// Removes email addresses and commenter ids, which identify the
+// commenters, from the exported comments
+func withoutPrivateData(articles []ArticleComments) []ArticleComments {
+	cleaned := make([]ArticleComments, len(articles))
+	for idx, article := range articles {
+		cleaned[idx] = ArticleComments{article.ArticleId, make([]Comment, len(article.Comments))}
+		for comment_idx, comment := range article.Comments {
+			comment.Email = ""
+			comment.CommenterId = ""
+			cleaned[idx].Comments[comment_idx] = comment
+		}
+	}
+	return cleaned
+}
+
+func wxrCommentStatus(comment Comment) string {
+	switch {
+	case comment.IsApproved():
+		return "1"
+	case comment.Status == commentStatusRejected:
+		return "spam"
+	case comment.Status == commentStatusDeleted:
+		return "trash"
+	}
+	return "0"
+}
+
+// Converts the comments to WXR. WordPress uses numeric comment ids, so
+// the comments are numbered in the export.
+func commentsToWxr(articles []ArticleComments) wxrOutput {
+	output := wxrOutput{Version: "2.0", WpNamespace: wxrNamespace}
+	output.Channel.Title = siteGlobal.TitleBase
+	output.Channel.Link = websiteAddress()
+	output.Channel.WxrVersion = "1.2"
+
+	numbers := make(map[string]int)
+	for _, article := range articles {
+		item := wxrOutputItem{}
+		item.Title = articleTitle(article.ArticleId)
+		item.Link = websiteAddress() + "/article/" + article.ArticleId
+		item.PostName = article.ArticleId
+		item.PostType = "post"
+		item.Status = "publish"
+
+		for _, comment := range article.Comments {
+			numbers[comment.Id] = len(numbers) + 1
+			item.Comments = append(item.Comments, wxrOutputComment{
+				Id:       numbers[comment.Id],
+				Author:   comment.Name,
+				Email:    comment.Email,
+				Date:     comment.TimeStamp.Local().Format(wxrTimeFormat),
+				DateGmt:  comment.TimeStamp.UTC().Format(wxrTimeFormat),
+				Content:  string(commentMarkdownToHtml(comment.CommentBody)),
+				Approved: wxrCommentStatus(comment),
+				Type:     "comment",
+				// Unknown parents are exported as top level comments
+				Parent: numbers[comment.ParentId],
+			})
+		}
+		output.Channel.Items = append(output.Channel.Items, item)
+	}
+	return output
+}
+
+func exportCommentsCommand(args []string) int {
+	flags := flag.NewFlagSet("export-comments", flag.ExitOnError)
+	format := flags.String("format", exportFormatJson, "Format of the export, 'json' or 'wxr'")
+	output_file := flags.String("out", "-", "Output file, '-' for standard output")
+	private := flags.Bool("private", false, "Include email addresses and commenter ids")
+	flags.Parse(args)
+
+	articles, err := getAllArticleComments(commentStore)
+	if err != nil {
+		fmt.Println("Failed to read comments: " + err.Error())
+		return 1
+	}
+	if !*private {
+		articles = withoutPrivateData(articles)
+	}
+
+	data := []byte{}
+	switch *format {
+	case exportFormatJson:
+		data, err = json.MarshalIndent(CommentExport{ParsableTime{time.Now()}, articles}, "", "    ")
+	case exportFormatWxr:
+		data, err = xml.MarshalIndent(commentsToWxr(articles), "", "    ")
+		data = append([]byte(xml.Header), data...)
+	default:
+		err = errors.New("Unknown format: " + *format)
+	}
+	if err != nil {
+		fmt.Println("Failed to export comments: " + err.Error())
+		return 1
+	}
+
+	if *output_file == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = ioutil.WriteFile(*output_file, data, 0644)
+	}
+	if err != nil {
+		fmt.Println("Failed to write export: " + err.Error())
+		return 1
+	}
+
+	num_comments := 0
+	for _, article := range articles {
+		num_comments += len(article.Comments)
+	}
+	fmt.Fprintln(os.Stderr, "Exported "+strconv.Itoa(num_comments)+" comments of "+
+		strconv.Itoa(len(articles))+" articles")
+	return 0
+}
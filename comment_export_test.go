@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportLeavesOutPrivateData(t *testing.T) {
+	articles := []ArticleComments{{"first", []Comment{{Id: "abc", Name: "Reader", CommentBody: "Hello",
+		TimeStamp: ParsableTime{time.Now()}, Email: "reader@example.com", CommenterId: "secret-id"}}}}
+
+	data, err := json.Marshal(CommentExport{ParsableTime{time.Now()}, withoutPrivateData(articles)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, private := range []string{"reader@example.com", "secret-id", "\"Email\"", "\"CommenterId\""} {
+		if strings.Contains(string(data), private) {
+			t.Errorf("Export contains %s: %s", private, data)
+		}
+	}
+	if !strings.Contains(string(data), "Hello") {
+		t.Error("Export does not contain the comment")
+	}
+	if articles[0].Comments[0].Email != "reader@example.com" {
+		t.Error("Comments read from the storage were changed")
+	}
+}
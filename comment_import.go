@@ -0,0 +1,347 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	importFormatDisqus = "disqus"
+	importFormatWxr    = "wxr"
+
+	wxrTimeFormat = "2006-01-02 15:04:05"
+)
+
+// Comment read from the export of another comment system
+type importedComment struct {
+	Comment
+	// Link of the commented page, gives the article id
+	Link string
+	// Ids in the other system, empty parent for top level comments
+	ExternalId       string
+	ExternalParentId string
+}
+
+// Disqus XML export. Threads are the commented pages and posts the
+// comments, linked by the dsq:id attributes.
+type disqusExport struct {
+	Threads []disqusThread `xml:"thread"`
+	Posts   []disqusPost   `xml:"post"`
+}
+
+type disqusThread struct {
+	Id   string `xml:"id,attr"`
+	Link string `xml:"link"`
+}
+
+type disqusReference struct {
+	Id string `xml:"id,attr"`
+}
+
+type disqusPost struct {
+	Id          string          `xml:"id,attr"`
+	Message     string          `xml:"message"`
+	CreatedAt   string          `xml:"createdAt"`
+	IsDeleted   bool            `xml:"isDeleted"`
+	IsSpam      bool            `xml:"isSpam"`
+	AuthorName  string          `xml:"author>name"`
+	AuthorEmail string          `xml:"author>email"`
+	Thread      disqusReference `xml:"thread"`
+	Parent      disqusReference `xml:"parent"`
+}
+
+// WordPress WXR export, only the parts needed for comments. Elements of
+// the 'wp' namespace are matched by their local names.
+type wxrDocument struct {
+	Items []wxrItem `xml:"channel>item"`
+}
+
+type wxrItem struct {
+	Link     string       `xml:"link"`
+	Comments []wxrComment `xml:"comment"`
+}
+
+type wxrComment struct {
+	Id       string `xml:"comment_id"`
+	Author   string `xml:"comment_author"`
+	Email    string `xml:"comment_author_email"`
+	Date     string `xml:"comment_date"`
+	DateGmt  string `xml:"comment_date_gmt"`
+	Content  string `xml:"comment_content"`
+	Approved string `xml:"comment_approved"`
+	Type     string `xml:"comment_type"`
+	Parent   string `xml:"comment_parent"`
+}
+
+// Imported comments are HTML, comments of this site are markdown
+var (
+	importCodeBlock = regexp.MustCompile(`(?is)<pre(?:\s[^>]*)?>(.*?)</pre>`)
+	importCode      = regexp.MustCompile(`(?i)</?code(\s[^>]*)?>`)
+	importLink      = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']*)["'][^>]*>(.*?)</a>`)
+	importLineBreak = regexp.MustCompile(`(?i)<br\s*/?>\n?`)
+	importParagraph = regexp.MustCompile(`(?i)</?p(\s[^>]*)?>`)
+	importTag       = regexp.MustCompile(`<[^>]*>`)
+	importEmptyLine = regexp.MustCompile(`\n{3,}`)
+)
+
+// Returns id of the article the link points to
+func articleIdOfLink(link string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", err
+	}
+	m := validArticle.FindStringSubmatch(strings.TrimSuffix(parsed.Path, "/"))
+	if m == nil {
+		return "", errors.New("Not an article link: " + link)
+	}
+	return m[2], nil
+}
+
+// Returns id of an imported comment. The id stays the same between imports,
+// such that importing again skips the already imported comments.
+func importedCommentId(format string, external_id string) string {
+	hash := sha1.Sum([]byte(format + ":" + external_id))
+	return hex.EncodeToString(hash[:8])
+}
+
+// Returns id for an imported comment which has no id in the export. The
+// id is derived from the content, such that importing again finds it.
+func fallbackExternalId(comment importedComment) string {
+	hash := sha1.Sum([]byte(comment.Link + "\n" + comment.TimeStamp.UTC().String() + "\n" +
+		comment.Name + "\n" + comment.CommentBody))
+	return "content:" + hex.EncodeToString(hash[:])
+}
+
+// Converts HTML of the imported comment to markdown. Formatting which
+// comments do not support is dropped.
+func importedBodyToMarkdown(body string) string {
+	body = importCodeBlock.ReplaceAllStringFunc(body, func(block string) string {
+		code := importCodeBlock.FindStringSubmatch(block)[1]
+		return "\n```\n" + strings.Trim(importTag.ReplaceAllString(code, ""), "\n") + "\n```\n"
+	})
+	body = importCode.ReplaceAllString(body, "`")
+	body = importLink.ReplaceAllString(body, "[$2]($1)")
+	body = importLineBreak.ReplaceAllString(body, "\n")
+	body = importParagraph.ReplaceAllString(body, "\n\n")
+	body = importTag.ReplaceAllString(body, "")
+	body = html.UnescapeString(body)
+	body = importEmptyLine.ReplaceAllString(body, "\n\n")
+	return strings.TrimSpace(body)
+}
+
+func parseDisqusExport(data []byte) ([]importedComment, error) {
+	export := disqusExport{}
+	if err := xml.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+
+	links := make(map[string]string)
+	for _, thread := range export.Threads {
+		links[thread.Id] = thread.Link
+	}
+
+	comments := []importedComment{}
+	for _, post := range export.Posts {
+		if post.IsDeleted {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, strings.TrimSpace(post.CreatedAt))
+		if err != nil {
+			return nil, errors.New("Post " + post.Id + " has invalid time: " + err.Error())
+		}
+
+		comment := importedComment{}
+		comment.Name = strings.TrimSpace(post.AuthorName)
+		comment.Email = strings.TrimSpace(post.AuthorEmail)
+		comment.CommentBody = importedBodyToMarkdown(post.Message)
+		comment.TimeStamp = ParsableTime{created}
+		comment.Status = commentStatusApproved
+		if post.IsSpam {
+			comment.Status = commentStatusRejected
+		}
+		comment.Link = links[post.Thread.Id]
+		comment.ExternalId = strings.TrimSpace(post.Id)
+		if len(comment.ExternalId) == 0 {
+			comment.ExternalId = fallbackExternalId(comment)
+		}
+		comment.ExternalParentId = post.Parent.Id
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+// Returns time of the WordPress comment. GMT time is empty or zero in
+// some exports, the local time of the blog is used then.
+func wxrCommentTime(comment wxrComment) (time.Time, error) {
+	created, err := time.Parse(wxrTimeFormat, strings.TrimSpace(comment.DateGmt))
+	if err != nil || created.Year() <= 1 {
+		return time.ParseInLocation(wxrTimeFormat, strings.TrimSpace(comment.Date), time.Local)
+	}
+	return created, nil
+}
+
+func parseWxrExport(data []byte) ([]importedComment, error) {
+	export := wxrDocument{}
+	if err := xml.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+
+	comments := []importedComment{}
+	for _, item := range export.Items {
+		for _, wxr_comment := range item.Comments {
+			// Pingbacks and trackbacks are not comments of this site
+			if len(wxr_comment.Type) > 0 && wxr_comment.Type != "comment" {
+				continue
+			}
+			created, err := wxrCommentTime(wxr_comment)
+			if err != nil {
+				return nil, errors.New("Comment " + wxr_comment.Id + " has invalid time: " + err.Error())
+			}
+
+			comment := importedComment{}
+			comment.Name = strings.TrimSpace(wxr_comment.Author)
+			comment.Email = strings.TrimSpace(wxr_comment.Email)
+			comment.CommentBody = importedBodyToMarkdown(wxr_comment.Content)
+			comment.TimeStamp = ParsableTime{created}
+			switch strings.TrimSpace(wxr_comment.Approved) {
+			case "1":
+				comment.Status = commentStatusApproved
+			case "0":
+				comment.Status = commentStatusPending
+			case "spam":
+				comment.Status = commentStatusRejected
+			default:
+				// Trash
+				continue
+			}
+			comment.Link = item.Link
+			comment.ExternalId = strings.TrimSpace(wxr_comment.Id)
+			if len(comment.ExternalId) == 0 {
+				// Nothing can reply to the comment, it only needs an id
+				comment.ExternalId = fallbackExternalId(comment)
+			}
+			if parent := strings.TrimSpace(wxr_comment.Parent); parent != "0" {
+				comment.ExternalParentId = parent
+			}
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+// Adds the imported comments to the comment storage. Comments which
+// have been imported before are skipped. Email addresses are only stored
+// as hashes, as the commenters have not asked for notifications.
+func importComments(store CommentStore, format string, imported []importedComment, dry_run bool) (int, int, int) {
+	// Parents must be added before the replies
+	sort.SliceStable(imported, func(i, j int) bool {
+		return imported[i].TimeStamp.Before(imported[j].TimeStamp.Time)
+	})
+
+	existing_ids := make(map[string]map[string]bool)
+	num_imported := 0
+	num_skipped := 0
+	num_failed := 0
+	for _, comment := range imported {
+		article_id, err := articleIdOfLink(comment.Link)
+		if err == nil {
+			if article, get_err := articleStore.Get(article_id); article == nil {
+				err = get_err
+			}
+		}
+		if err != nil {
+			fmt.Println("Skipping comment " + comment.ExternalId + ": " + err.Error())
+			num_failed++
+			continue
+		}
+
+		if existing_ids[article_id] == nil {
+			existing, err := store.List(article_id)
+			if err != nil {
+				fmt.Println("Failed to read comments of article " + article_id + ": " + err.Error())
+				num_failed++
+				continue
+			}
+			existing_ids[article_id] = make(map[string]bool)
+			for _, existing_comment := range existing {
+				existing_ids[article_id][existing_comment.Id] = true
+			}
+		}
+
+		comment.Id = importedCommentId(format, comment.ExternalId)
+		if existing_ids[article_id][comment.Id] {
+			num_skipped++
+			continue
+		}
+		if len(comment.ExternalParentId) > 0 {
+			comment.ParentId = importedCommentId(format, comment.ExternalParentId)
+		}
+		if len(comment.Email) > 0 {
+			comment.EmailHash = hashEmail(comment.Email)
+		}
+		comment.Email = ""
+
+		if !dry_run {
+			if _, err = store.Add(article_id, comment.Comment); err != nil {
+				fmt.Println("Failed to import comment of article " + article_id + ": " + err.Error())
+				num_failed++
+				continue
+			}
+		}
+		existing_ids[article_id][comment.Id] = true
+		num_imported++
+	}
+	return num_imported, num_skipped, num_failed
+}
+
+// Command 'import-comments'. A running server shows the imported comments
+// after its next check for changes, see ArticleStore.Watch and
+// SqliteCommentStore.Watch.
+func importCommentsCommand(args []string) int {
+	flags := flag.NewFlagSet("import-comments", flag.ExitOnError)
+	format := flags.String("format", importFormatDisqus, "Format of the file, 'disqus' or 'wxr'")
+	dry_run := flags.Bool("dry-run", false, "Only report what would be imported")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: import-comments [-format disqus|wxr] [-dry-run] file")
+		return 2
+	}
+
+	data, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Println("Failed to read export: " + err.Error())
+		return 1
+	}
+
+	imported := []importedComment{}
+	switch *format {
+	case importFormatDisqus:
+		imported, err = parseDisqusExport(data)
+	case importFormatWxr:
+		imported, err = parseWxrExport(data)
+	default:
+		err = errors.New("Unknown format: " + *format)
+	}
+	if err != nil {
+		fmt.Println("Failed to parse export: " + err.Error())
+		return 1
+	}
+
+	num_imported, num_skipped, num_failed := importComments(commentStore, *format, imported, *dry_run)
+	fmt.Printf("Imported %d comments, skipped %d existing, %d failed\n", num_imported, num_skipped, num_failed)
+	if num_failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+const testDisqusExport = `<?xml version="1.0" encoding="utf-8"?>
+<disqus xmlns:dsq="http://disqus.com/disqus-internals">
+<thread dsq:id="10">
+	<link>https://example.com/article/first/</link>
+</thread>
+<post dsq:id="100">
+	<message><![CDATA[<p>Nice <a href="https://example.com/more">post</a></p>]]></message>
+	<createdAt>2020-01-01T10:00:00Z</createdAt>
+	<isDeleted>false</isDeleted>
+	<isSpam>false</isSpam>
+	<author><name>Reader</name><email>reader@example.com</email></author>
+	<thread dsq:id="10"/>
+</post>
+<post dsq:id="101">
+	<message><![CDATA[<p>Thanks</p>]]></message>
+	<createdAt>2020-01-01T11:00:00Z</createdAt>
+	<isDeleted>false</isDeleted>
+	<isSpam>false</isSpam>
+	<author><name>Writer</name></author>
+	<thread dsq:id="10"/>
+	<parent dsq:id="100"/>
+</post>
+<post dsq:id="102">
+	<message><![CDATA[<p>Buy things</p>]]></message>
+	<createdAt>2020-01-01T12:00:00Z</createdAt>
+	<isDeleted>false</isDeleted>
+	<isSpam>true</isSpam>
+	<author><name>Spammer</name></author>
+	<thread dsq:id="10"/>
+</post>
+<post dsq:id="103">
+	<message><![CDATA[<p>Removed</p>]]></message>
+	<createdAt>2020-01-01T13:00:00Z</createdAt>
+	<isDeleted>true</isDeleted>
+	<isSpam>false</isSpam>
+	<author><name>Reader</name></author>
+	<thread dsq:id="10"/>
+</post>
+</disqus>`
+
+const testWxrWithoutIds = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+<item>
+	<link>https://example.com/article/first</link>
+	<wp:comment>
+		<wp:comment_author>Reader</wp:comment_author>
+		<wp:comment_date_gmt>2020-01-01 10:00:00</wp:comment_date_gmt>
+		<wp:comment_content>First</wp:comment_content>
+		<wp:comment_approved>1</wp:comment_approved>
+		<wp:comment_parent>0</wp:comment_parent>
+	</wp:comment>
+	<wp:comment>
+		<wp:comment_author>Reader</wp:comment_author>
+		<wp:comment_date_gmt>2020-01-01 11:00:00</wp:comment_date_gmt>
+		<wp:comment_content>Second</wp:comment_content>
+		<wp:comment_approved>1</wp:comment_approved>
+		<wp:comment_parent>0</wp:comment_parent>
+	</wp:comment>
+</item>
+</channel>
+</rss>`
+
+func TestImportWxrCommentsWithoutIds(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+
+	for round, expected := range []int{2, 0} {
+		imported, err := parseWxrExport([]byte(testWxrWithoutIds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		num_imported, num_skipped, num_failed := importComments(commentStore, importFormatWxr, imported, false)
+		if num_imported != expected || num_skipped != 2-expected || num_failed != 0 {
+			t.Errorf("Round %d: imported %d, skipped %d, failed %d", round, num_imported, num_skipped, num_failed)
+		}
+	}
+
+	comments, err := commentStore.List("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[0].Id == comments[1].Id {
+		t.Errorf("Stored comments %+v", comments)
+	}
+}
+
+// Comments imported from Disqus, exported as WXR and imported again keep
+// their authors, bodies, threading and moderation status
+func TestImportDisqusAndWxrRoundTrip(t *testing.T) {
+	setupTestContent(t)
+	siteGlobal.Address = "https://example.com"
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+
+	imported, err := parseDisqusExport([]byte(testDisqusExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	num_imported, _, num_failed := importComments(commentStore, importFormatDisqus, imported, false)
+	if num_imported != 3 || num_failed != 0 {
+		t.Fatalf("Imported %d, failed %d from Disqus", num_imported, num_failed)
+	}
+	from_disqus, err := commentStore.List("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImportedComments(t, "Disqus", from_disqus)
+	if from_disqus[0].EmailHash != hashEmail("reader@example.com") {
+		t.Error("Email of the Disqus comment was not hashed")
+	}
+
+	articles, err := getAllArticleComments(commentStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := xml.Marshal(commentsToWxr(articles))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Import to an empty comment storage of the same articles
+	commentStore = NewFileCommentStore(t.TempDir())
+	imported, err = parseWxrExport(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	num_imported, _, num_failed = importComments(commentStore, importFormatWxr, imported, false)
+	if num_imported != 3 || num_failed != 0 {
+		t.Fatalf("Imported %d, failed %d from WXR", num_imported, num_failed)
+	}
+	from_wxr, err := commentStore.List("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImportedComments(t, "WXR", from_wxr)
+}
+
+func checkImportedComments(t *testing.T, format string, comments []Comment) {
+	t.Helper()
+	if len(comments) != 3 {
+		t.Fatalf("%s: %d comments stored", format, len(comments))
+	}
+	first, reply, spam := comments[0], comments[1], comments[2]
+	if first.Name != "Reader" || first.CommentBody != "Nice [post](https://example.com/more)" {
+		t.Errorf("%s: first comment %+v", format, first)
+	}
+	if first.Email != "" {
+		t.Errorf("%s: email address of the first comment was stored", format)
+	}
+	if reply.Name != "Writer" || reply.CommentBody != "Thanks" || reply.ParentId != first.Id {
+		t.Errorf("%s: reply %+v", format, reply)
+	}
+	if !first.IsApproved() || !reply.IsApproved() || spam.Status != commentStatusRejected {
+		t.Errorf("%s: statuses %v, %v, %v", format, first.Status, reply.Status, spam.Status)
+	}
+	if !first.TimeStamp.Equal(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("%s: time of the first comment is %v", format, first.TimeStamp)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/russross/blackfriday"
+	"html"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Longest comment which is previewed
+	maxCommentPreviewBytes = 64 * 1024
+
+	// Links in comments are not endorsed by the site
+	commentLinkRel = "nofollow ugc"
+)
+
+// Tags allowed in rendered comments, with the attributes allowed for each
+var commentAllowedTags = map[string][]string{
+	"p":          {},
+	"br":         {},
+	"em":         {},
+	"strong":     {},
+	"del":        {},
+	"code":       {"class"},
+	"pre":        {},
+	"blockquote": {},
+	"ul":         {},
+	"ol":         {},
+	"li":         {},
+	"a":          {"href"},
+}
+
+var (
+	commentHtmlTag       = regexp.MustCompile("<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\\s+[a-zA-Z-]+=\"[^\"]*\")*)\\s*/?>")
+	commentHtmlAttribute = regexp.MustCompile("([a-zA-Z-]+)=\"([^\"]*)\"")
+
+	// Highlighting language of fenced code blocks
+	codeLanguageClass = regexp.MustCompile("^language-[a-zA-Z0-9_+-]+$")
+	safeLink          = regexp.MustCompile("^(https?://|mailto:|/|#)")
+)
+
+// Returns true if the attribute with the value is allowed in the tag
+func allowedCommentAttribute(tag string, name string, value string) bool {
+	for _, allowed := range commentAllowedTags[tag] {
+		if allowed != name {
+			continue
+		}
+		switch name {
+		case "class":
+			return codeLanguageClass.MatchString(value)
+		case "href":
+			return safeLink.MatchString(value)
+		}
+		return true
+	}
+	return false
+}
+
+// Removes tags and attributes which are not in the allow-list. Tags are
+// rebuilt from the allowed parts, text between the tags is escaped again
+// such that nothing but the allowed tags can get through.
+func sanitizeCommentHtml(input string) string {
+	output := ""
+	escape := strings.NewReplacer("<", "&lt;", ">", "&gt;")
+
+	position := 0
+	for _, m := range commentHtmlTag.FindAllStringSubmatchIndex(input, -1) {
+		output += escape.Replace(input[position:m[0]])
+		position = m[1]
+
+		closing := input[m[2]:m[3]] == "/"
+		tag := strings.ToLower(input[m[4]:m[5]])
+		if _, allowed := commentAllowedTags[tag]; !allowed {
+			continue
+		}
+		if closing {
+			output += "</" + tag + ">"
+			continue
+		}
+
+		output += "<" + tag
+		for _, attribute := range commentHtmlAttribute.FindAllStringSubmatch(input[m[6]:m[7]], -1) {
+			name := strings.ToLower(attribute[1])
+			value := html.UnescapeString(attribute[2])
+			if allowedCommentAttribute(tag, name, value) {
+				output += " " + name + "=\"" + html.EscapeString(value) + "\""
+			}
+		}
+		if tag == "a" {
+			output += " rel=\"" + commentLinkRel + "\""
+		}
+		output += ">"
+	}
+	output += escape.Replace(input[position:])
+
+	return output
+}
+
+// Converts markdown of a comment to HTML. Only a restricted set of markdown
+// is supported, HTML tags and images in the comment are removed.
+func commentMarkdownToHtml(body string) template.HTML {
+	htmlFlags := 0
+	htmlFlags |= blackfriday.HTML_SKIP_HTML
+	htmlFlags |= blackfriday.HTML_SKIP_STYLE
+	htmlFlags |= blackfriday.HTML_SKIP_IMAGES
+	htmlFlags |= blackfriday.HTML_SAFELINK
+	htmlFlags |= blackfriday.HTML_USE_SMARTYPANTS
+	htmlFlags |= blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
+	renderer := blackfriday.HtmlRenderer(htmlFlags, "", "")
+
+	extensions := 0
+	extensions |= blackfriday.EXTENSION_NO_INTRA_EMPHASIS
+	extensions |= blackfriday.EXTENSION_FENCED_CODE
+	extensions |= blackfriday.EXTENSION_AUTOLINK
+	extensions |= blackfriday.EXTENSION_STRIKETHROUGH
+	extensions |= blackfriday.EXTENSION_HARD_LINE_BREAK
+
+	// Same LaTeX handling as in the articles, MathJax renders the math
+	body_escaped := escapeLatex([]byte(body))
+
+	body_html := blackfriday.Markdown(body_escaped, renderer, extensions)
+
+	return template.HTML(sanitizeCommentHtml(string(body_html)))
+}
+
+// Returns the comment posted in the form as HTML, used for previewing the
+// comment before sending it
+func commentPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxCommentPreviewBytes)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(commentMarkdownToHtml(r.FormValue("comment"))))
+}
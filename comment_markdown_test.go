@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeCommentHtml(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`<p>Hello <em>world</em></p>`, `<p>Hello <em>world</em></p>`},
+		{`<script>alert(1)</script>`, `alert(1)`},
+		{`<p onclick="alert(1)">x</p>`, `<p>x</p>`},
+		{`<img src="x" onerror="alert(1)">`, ``},
+		{`<a href="javascript:alert(1)">x</a>`, `<a rel="nofollow ugc">x</a>`},
+		{`<a href="https://example.com/?a=1&amp;b=2">x</a>`,
+			`<a href="https://example.com/?a=1&amp;b=2" rel="nofollow ugc">x</a>`},
+		{`<code class="language-go">x</code>`, `<code class="language-go">x</code>`},
+		{`<code class="x onmouseover">x</code>`, `<code>x</code>`},
+		// Broken tags are left as text
+		{`<a href="x"<script>`, `&lt;a href="x"`},
+	}
+	for _, test := range tests {
+		if output := sanitizeCommentHtml(test.input); output != test.expected {
+			t.Errorf("Sanitized '%s' to '%s', expected '%s'", test.input, output, test.expected)
+		}
+	}
+}
+
+func TestCommentMarkdownToHtml(t *testing.T) {
+	output := string(commentMarkdownToHtml("Hello <script>alert(1)</script> [x](javascript:alert(1)) ![i](x.png)"))
+	for _, unsafe := range []string{"<script", "javascript:", "<img"} {
+		if strings.Contains(output, unsafe) {
+			t.Errorf("Comment HTML contains '%s': %s", unsafe, output)
+		}
+	}
+
+	// Math is left for MathJax without markdown emphasis
+	output = string(commentMarkdownToHtml("Sum $a_i + b_i$ here"))
+	if !strings.Contains(output, "$a_i + b_i$") || strings.Contains(output, "<em>") {
+		t.Errorf("Math was changed: %s", output)
+	}
+
+	// Math can not add links or styles after the sanitizing
+	if !strings.Contains(string(articleScripts), `extensions: ["Safe.js"]`) {
+		t.Error("MathJax is configured without the Safe extension")
+	}
+}
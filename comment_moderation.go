@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// New comments wait for the admin before they are shown
+	commentStatusPending  = "pending"
+	commentStatusApproved = "approved"
+	commentStatusRejected = "rejected"
+	// Deleted by the commenter, kept for the admin
+	commentStatusDeleted = "deleted"
+
+	// Identifies commenters between visits, used for auto-approving
+	commenterCookieName = "buq2_commenter"
+	commenterCookieDays = 365
+
+	csrfCookieName = "buq2_csrf"
+)
+
+// Comment with the article it belongs to, shown on the moderation page
+type ModeratedComment struct {
+	Comment
+	ArticleId    string
+	ArticleTitle string
+}
+
+type AdminCommentsData struct {
+	SiteGlobal
+	PageData
+	Comments []ModeratedComment
+	// Status of the shown comments
+	Status    string
+	CsrfToken string
+}
+
+// Returns true if the comment is shown on the article page. Comments
+// without status were written before moderation and have been visible.
+func (comment Comment) IsApproved() bool {
+	return comment.Status == "" || comment.Status == commentStatusApproved
+}
+
+// Returns only comments which are shown on the article page
+func approvedComments(comments []Comment) []Comment {
+	approved := []Comment{}
+	for _, comment := range comments {
+		if comment.IsApproved() {
+			approved = append(approved, comment)
+		}
+	}
+	return approved
+}
+
+func findComment(article_id string, comment_id string) (Comment, error) {
+	comments, err := commentStore.List(article_id)
+	if err != nil {
+		return Comment{}, err
+	}
+	for _, comment := range comments {
+		if comment.Id == comment_id {
+			return comment, nil
+		}
+	}
+	return Comment{}, ErrCommentNotFound
+}
+
+// Returns id of the commenter from the commenter cookie, empty if the
+// user has not commented before
+func getCommenterId(r *http.Request) string {
+	cookie, err := r.Cookie(commenterCookieName)
+	if err != nil {
+		return ""
+	}
+	id := ""
+	if err = secureCookie.Decode(commenterCookieName, cookie.Value, &id); err != nil {
+		log.Print("Could not decode commenter cookie")
+		return ""
+	}
+	return id
+}
+
+func setCommenterCookie(w http.ResponseWriter, id string) {
+	encoded, err := secureCookie.Encode(commenterCookieName, id)
+	if err != nil {
+		log.Print("Failed to create commenter cookie: " + err.Error())
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     commenterCookieName,
+		Value:    encoded,
+		Path:     "/",
+		Expires:  time.Now().AddDate(0, 0, commenterCookieDays),
+		HttpOnly: true,
+	})
+}
+
+// Returns true if the commenter has an approved comment on any article
+func isReturningCommenter(commenter_id string) bool {
+	if len(commenter_id) == 0 {
+		return false
+	}
+	article_ids, err := commentStore.ArticleIds()
+	if err != nil {
+		log.Print("Failed to list commented articles: " + err.Error())
+		return false
+	}
+	for _, article_id := range article_ids {
+		comments, err := commentStore.List(article_id)
+		if err != nil {
+			continue
+		}
+		for _, comment := range comments {
+			if comment.CommenterId == commenter_id && comment.IsApproved() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns status of a new comment by the commenter
+func newCommentStatus(commenter_id string) string {
+	if siteGlobal.AutoApproveReturningCommenters && isReturningCommenter(commenter_id) {
+		return commentStatusApproved
+	}
+	return commentStatusPending
+}
+
+// Returns token which must be posted with the moderation forms, such that
+// other sites can not make the admin's browser moderate comments
+func getCsrfToken(cookie *SiteCookie) string {
+	token, err := secureCookie.Encode(csrfCookieName, cookie.UserId)
+	if err != nil {
+		log.Print("Failed to create CSRF token: " + err.Error())
+		return ""
+	}
+	return token
+}
+
+func checkCsrfToken(cookie *SiteCookie, token string) bool {
+	user_id := ""
+	if err := secureCookie.Decode(csrfCookieName, token, &user_id); err != nil {
+		return false
+	}
+	return user_id == cookie.UserId
+}
+
+// Returns comments of all articles with the status, newest first
+func getModeratedComments(status string) ([]ModeratedComment, error) {
+	article_ids, err := commentStore.ArticleIds()
+	if err != nil {
+		return nil, err
+	}
+
+	moderated := []ModeratedComment{}
+	for _, article_id := range article_ids {
+		comments, err := commentStore.List(article_id)
+		if err != nil {
+			return nil, err
+		}
+
+		title := article_id
+		if article, _ := articleStore.Get(article_id); article != nil {
+			title = article.Title
+		}
+
+		for _, comment := range comments {
+			if comment.Status == status || (status == commentStatusApproved && comment.IsApproved()) {
+				moderated = append(moderated, ModeratedComment{comment, article_id, title})
+			}
+		}
+	}
+
+	sort.SliceStable(moderated, func(i, j int) bool {
+		return moderated[i].TimeStamp.After(moderated[j].TimeStamp.Time)
+	})
+	return moderated, nil
+}
+
+// Applies moderation action to the comment
+func moderateComment(action string, article_id string, comment_id string, r *http.Request) error {
+	if action == "delete" {
+		return commentStore.Delete(article_id, comment_id)
+	}
+
+	comment, err := findComment(article_id, comment_id)
+	if err != nil {
+		return err
+	}
+	was_approved := comment.IsApproved()
+	switch action {
+	case "approve":
+		trainSpamClassifier(&comment, false)
+		comment.Status = commentStatusApproved
+	case "reject":
+		trainSpamClassifier(&comment, true)
+		comment.Status = commentStatusRejected
+	case "edit":
+		comment.Name = r.FormValue("user")
+		comment.CommentBody = r.FormValue("comment")
+	default:
+		return errors.New("Unknown moderation action: " + action)
+	}
+
+	err = commentStore.Update(article_id, comment)
+	if err == nil && comment.IsApproved() && !was_approved {
+		notifyReplySubscribers(article_id, comment)
+	}
+	return err
+}
+
+// Teaches the moderation decision to the spam classifier. If the classifier
+// was trained with an earlier decision, the earlier one is forgotten. The
+// decision is stored to the comment, which must be saved afterwards.
+func trainSpamClassifier(comment *Comment, is_spam bool) {
+	trained := spamTrainedHam
+	if is_spam {
+		trained = spamTrainedSpam
+	}
+	if comment.SpamTrained == trained {
+		return
+	}
+
+	err := error(nil)
+	if len(comment.SpamTrained) > 0 {
+		err = spamClassifier.Train(*comment, comment.SpamTrained == spamTrainedSpam, -1)
+	}
+	if err == nil {
+		err = spamClassifier.Train(*comment, is_spam, 1)
+	}
+	if err != nil {
+		log.Print("Failed to train spam classifier: " + err.Error())
+		return
+	}
+	comment.SpamTrained = trained
+}
+
+func adminCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	cookie := getCookie(r)
+	if !cookie.IsAdmin() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	status := r.FormValue("status")
+	switch status {
+	case commentStatusApproved, commentStatusRejected, commentStatusDeleted:
+	default:
+		status = commentStatusPending
+	}
+
+	if r.Method == "POST" {
+		if !checkCsrfToken(cookie, r.FormValue("csrf")) {
+			http.Error(w, "Invalid form token", http.StatusForbidden)
+			return
+		}
+
+		article_id := r.FormValue("article")
+		err := moderateComment(r.FormValue("action"), article_id, r.FormValue("id"), r)
+		if err != nil {
+			log.Print("Failed to moderate comment: " + err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		articleStore.Invalidate(article_id)
+
+		// Redirect such that reloading does not post the form again
+		http.Redirect(w, r, "/admin/comments?status="+status, http.StatusSeeOther)
+		return
+	}
+
+	comments, err := getModeratedComments(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := AdminCommentsData{}
+	data.SiteGlobal = siteGlobal
+	data.PageData = newPageData()
+	data.Title = "Comments"
+	data.Comments = comments
+	data.Status = status
+	data.CsrfToken = getCsrfToken(cookie)
+
+	renderTemplate(w, "admin_comments", data)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestModerationTrainsClassifierOnce(t *testing.T) {
+	setupTestContent(t)
+	spamClassifier.Train(Comment{CommentBody: "Buy pills"}, true, 1)
+	// Rejected by the spam rules, the classifier has not seen it
+	comment, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Useful words",
+		TimeStamp: ParsableTime{time.Now()}, Status: commentStatusRejected})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(action string, spam_comments int, ham_comments int) {
+		t.Helper()
+		if err := moderateComment(action, "first", comment.Id, nil); err != nil {
+			t.Fatal(err)
+		}
+		model := spamClassifier.model
+		if model.SpamComments != spam_comments || model.HamComments != ham_comments {
+			t.Errorf("After %s: %d spam and %d ham comments", action, model.SpamComments, model.HamComments)
+		}
+	}
+
+	expect("approve", 1, 1)
+	expect("approve", 1, 1)
+	expect("reject", 2, 0)
+
+	stored, err := findComment("first", comment.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SpamTrained != spamTrainedSpam {
+		t.Errorf("Stored training decision is '%s'", stored.SpamTrained)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	moderationTokenName  = "buq2_moderate"
+	unsubscribeTokenName = "buq2_unsubscribe"
+)
+
+// Content of the approve and reject links sent to the admin
+type moderationToken struct {
+	ArticleId string
+	CommentId string
+	Action    string
+}
+
+// Content of the unsubscribe links sent to the commenters
+type unsubscribeToken struct {
+	ArticleId string
+	Email     string
+}
+
+// Links in the email are followed by scanners, so the action needs
+// a confirmation
+var moderationTemplate = template.Must(template.New("").Parse(`
+<html>
+<body>
+{{if .Done}}
+    Comment {{.Action}}d. <a href="/admin/comments">Moderate comments</a>
+{{else}}
+    <form action="/comment/moderate" method="POST">
+        <input type="hidden" name="token" value="{{.Token}}">
+        <input type="submit" value="{{.Action}}">
+    </form>
+{{end}}
+</body>
+</html>
+`))
+
+var unsubscribeTemplate = template.Must(template.New("").Parse(`
+<html>
+<body>
+{{if .Done}}
+    You will not receive notifications of new replies to <a href="{{.ArticleLink}}">the article</a> anymore.
+{{else}}
+    <form action="/comment/unsubscribe" method="POST">
+        <input type="hidden" name="token" value="{{.Token}}">
+        <input type="submit" value="Stop reply notifications">
+    </form>
+{{end}}
+</body>
+</html>
+`))
+
+// Sends the mail in the background, such that the commenter does not need
+// to wait for the mail server
+func sendMail(mail Mail) {
+	if mailer == nil || len(mail.To) == 0 {
+		return
+	}
+	go func() {
+		err := mailer.Send(mail)
+		if err != nil {
+			log.Print("Failed to send mail to " + strings.Join(mail.To, ", ") + ": " + err.Error())
+		}
+	}()
+}
+
+func articleTitle(article_id string) string {
+	if article, _ := articleStore.Get(article_id); article != nil {
+		return article.Title
+	}
+	return article_id
+}
+
+func moderationLink(article_id string, comment_id string, action string) string {
+	token, err := secureCookie.Encode(moderationTokenName, moderationToken{article_id, comment_id, action})
+	if err != nil {
+		log.Print("Failed to create moderation link: " + err.Error())
+		return ""
+	}
+	return websiteAddress() + "/comment/moderate?token=" + url.QueryEscape(token)
+}
+
+func unsubscribeLink(article_id string, email string) string {
+	token, err := permanentCookie.Encode(unsubscribeTokenName, unsubscribeToken{article_id, email})
+	if err != nil {
+		log.Print("Failed to create unsubscribe link: " + err.Error())
+		return ""
+	}
+	return websiteAddress() + "/comment/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// Tells the site owner about a new comment. Rejected spam is not sent.
+func notifyNewComment(article_id string, comment Comment) {
+	if mailer == nil || len(websiteEmail()) == 0 || comment.Status == commentStatusRejected {
+		return
+	}
+
+	title := articleTitle(article_id)
+	body := "New comment to '" + title + "'\n" +
+		websiteAddress() + "/article/" + article_id + "\n\n" +
+		"From: " + comment.Name + "\n"
+	if len(comment.SpamReason) > 0 {
+		body += "Spam filter: " + comment.SpamReason + "\n"
+	}
+	body += "\n" + comment.CommentBody + "\n\n"
+	if !comment.IsApproved() {
+		body += "The comment awaits moderation.\n"
+		body += "Approve: " + moderationLink(article_id, comment.Id, "approve") + "\n"
+	}
+	body += "Reject: " + moderationLink(article_id, comment.Id, "reject") + "\n"
+
+	subject := "New comment to " + title
+	if !comment.IsApproved() {
+		subject = "Pending comment to " + title
+	}
+	sendMail(Mail{To: []string{websiteEmail()}, Subject: subject, Body: body})
+}
+
+// Returns id of the top level comment of the thread
+func threadRootId(by_id map[string]Comment, comment Comment) string {
+	// Limit protects from loops in broken comment files
+	for depth := 0; depth < len(by_id) && len(comment.ParentId) > 0; depth++ {
+		parent, found := by_id[comment.ParentId]
+		if !found {
+			break
+		}
+		comment = parent
+	}
+	return comment.Id
+}
+
+// Tells earlier commenters of the thread about a new reply. Called when the
+// reply is shown on the page.
+func notifyReplySubscribers(article_id string, reply Comment) {
+	if mailer == nil || len(reply.ParentId) == 0 {
+		return
+	}
+	comments, err := commentStore.List(article_id)
+	if err != nil {
+		log.Print("Failed to read comments for notifications: " + err.Error())
+		return
+	}
+
+	by_id := make(map[string]Comment)
+	for _, comment := range comments {
+		by_id[comment.Id] = comment
+	}
+	root := threadRootId(by_id, reply)
+
+	title := articleTitle(article_id)
+	link := websiteAddress() + "/article/" + article_id
+	notified := map[string]bool{strings.ToLower(reply.Email): true}
+	for _, comment := range comments {
+		email := strings.ToLower(comment.Email)
+		if !comment.NotifyReplies || len(email) == 0 || notified[email] || !comment.IsApproved() ||
+			comment.TimeStamp.After(reply.TimeStamp.Time) || threadRootId(by_id, comment) != root {
+			continue
+		}
+		notified[email] = true
+
+		unsubscribe := unsubscribeLink(article_id, comment.Email)
+		body := reply.Name + " replied in a discussion you took part in on '" + title + "'\n" +
+			link + "\n\n" + reply.CommentBody + "\n\n" +
+			"Stop notifications of this article: " + unsubscribe + "\n"
+		sendMail(Mail{
+			To:      []string{comment.Email},
+			Subject: "New reply to " + title,
+			Body:    body,
+			Headers: map[string]string{
+				"List-Unsubscribe":      "<" + unsubscribe + ">",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			},
+		})
+	}
+}
+
+// Approves or rejects a comment with a link from the notification email
+func commentModerateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	token_string := r.FormValue("token")
+	token := moderationToken{}
+	err := secureCookie.Decode(moderationTokenName, token_string, &token)
+	if err != nil || (token.Action != "approve" && token.Action != "reject") {
+		http.NotFound(w, r)
+		log.Print("Invalid moderation token")
+		return
+	}
+
+	if r.Method != "POST" {
+		moderationTemplate.Execute(w, map[string]interface{}{"Token": token_string, "Action": token.Action})
+		return
+	}
+
+	err = moderateComment(token.Action, token.ArticleId, token.CommentId, r)
+	if err != nil {
+		log.Print("Failed to moderate comment: " + err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	articleStore.Invalidate(token.ArticleId)
+
+	moderationTemplate.Execute(w, map[string]interface{}{"Done": true, "Action": token.Action})
+}
+
+// Stops reply notifications of the article to the email address. GET
+// shows a confirmation, as link scanners of mail services follow links.
+// POST unsubscribes, which is also the one-click unsubscribe of mail
+// clients (RFC 8058).
+func commentUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	token_string := r.FormValue("token")
+	token := unsubscribeToken{}
+	err := permanentCookie.Decode(unsubscribeTokenName, token_string, &token)
+	if err != nil {
+		http.NotFound(w, r)
+		log.Print("Invalid unsubscribe token")
+		return
+	}
+
+	if r.Method != "POST" {
+		unsubscribeTemplate.Execute(w, map[string]interface{}{"Token": token_string})
+		return
+	}
+
+	comments, err := commentStore.List(token.ArticleId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, comment := range comments {
+		if comment.NotifyReplies && strings.EqualFold(comment.Email, token.Email) {
+			comment.NotifyReplies = false
+			// Address is not needed anymore
+			comment.Email = ""
+			err = commentStore.Update(token.ArticleId, comment)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	articleStore.Invalidate(token.ArticleId)
+
+	unsubscribeTemplate.Execute(w, map[string]interface{}{"Done": true,
+		"ArticleLink": websiteAddress() + "/article/" + token.ArticleId})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnsubscribeNeedsPost(t *testing.T) {
+	setupTestContent(t)
+	setupTestCookies(t)
+	comment, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Hello",
+		TimeStamp: ParsableTime{time.Now()}, Email: "reader@example.com", NotifyReplies: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := url.Parse(unsubscribeLink("first", "Reader@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	commentUnsubscribeHandler(w, httptest.NewRequest("GET", link.RequestURI(), nil))
+	if !strings.Contains(w.Body.String(), `method="POST"`) {
+		t.Error("GET did not show the confirmation")
+	}
+	if stored, _ := findComment("first", comment.Id); !stored.NotifyReplies {
+		t.Fatal("GET unsubscribed")
+	}
+
+	// One-click unsubscribe of mail clients
+	r := httptest.NewRequest("POST", link.RequestURI(), strings.NewReader("List-Unsubscribe=One-Click"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	commentUnsubscribeHandler(httptest.NewRecorder(), r)
+	stored, err := findComment("first", comment.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.NotifyReplies || len(stored.Email) > 0 {
+		t.Error("POST did not unsubscribe")
+	}
+}
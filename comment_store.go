@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Storage of the comments of all articles
+type CommentStore interface {
+	// Returns comments of the article, oldest first
+	List(article_id string) ([]Comment, error)
+	// Adds the comment and returns it with the id set
+	Add(article_id string, comment Comment) (Comment, error)
+	// Replaces the comment with the same id
+	Update(article_id string, comment Comment) error
+	Delete(article_id string, comment_id string) error
+	Count(article_id string) (int, error)
+	// Returns ids of the articles which have comments
+	ArticleIds() ([]string, error)
+}
+
+const (
+	commentStorageFile   = "file"
+	commentStorageSqlite = "sqlite"
+)
+
+var (
+	ErrCommentNotFound = errors.New("Comment not found")
+
+	// Set by initCommentStore
+	commentStore CommentStore
+)
+
+// Opens the comment storage selected in the site config
+func initCommentStore() error {
+	switch siteGlobal.CommentStorage {
+	case "", commentStorageFile:
+		commentStore = NewFileCommentStore(GetCommentFolder())
+	case commentStorageSqlite:
+		store, err := NewSqliteCommentStore(getCommentDatabase())
+		if err != nil {
+			return err
+		}
+		commentStore = store
+	default:
+		return errors.New("Unknown comment storage: " + siteGlobal.CommentStorage)
+	}
+	return nil
+}
+
+// Returns new random comment id
+func newCommentId() string {
+	bytes := make([]byte, 8)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		log.Print("Failed to generate random comment id: " + err.Error())
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// Returns id for comments written before comments had ids. The id is
+// derived from the content such that it stays the same between reads.
+func legacyCommentId(comment Comment) string {
+	hash := sha1.Sum([]byte(comment.TimeStamp.AsString() + "\n" + comment.Name + "\n" + comment.CommentBody))
+	return hex.EncodeToString(hash[:8])
+}
+
+// Stores comments of each article in a JSON file named after the article
+type FileCommentStore struct {
+	Folder string
+
+	// Writing needs a lock. This could be per article, but I don't think
+	// that there will be so many comments per seconds...
+	mutex sync.Mutex
+}
+
+func NewFileCommentStore(folder string) *FileCommentStore {
+	store := new(FileCommentStore)
+	store.Folder = folder
+	return store
+}
+
+func (store *FileCommentStore) filename(article_id string) string {
+	return store.Folder + "/" + article_id + commentExtension
+}
+
+func (store *FileCommentStore) ArticleIds() ([]string, error) {
+	ids := []string{}
+	files, err := ioutil.ReadDir(store.Folder)
+	if os.IsNotExist(err) {
+		return ids, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		ext := path.Ext(file.Name())
+		if ext == commentExtension {
+			ids = append(ids, strings.TrimSuffix(file.Name(), ext))
+		}
+	}
+	return ids, nil
+}
+
+func (store *FileCommentStore) List(article_id string) ([]Comment, error) {
+	comments := Comments{}
+
+	comment_data, err := ioutil.ReadFile(store.filename(article_id))
+	if os.IsNotExist(err) {
+		// No comments yet
+		return []Comment{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(comment_data, &comments)
+	if err != nil {
+		return nil, errors.New("Failed to parse comments of article " + article_id + ": " + err.Error())
+	}
+
+	for idx := range comments.Comments {
+		if len(comments.Comments[idx].Id) == 0 {
+			comments.Comments[idx].Id = legacyCommentId(comments.Comments[idx])
+		}
+	}
+	if comments.Comments == nil {
+		comments.Comments = []Comment{}
+	}
+
+	return comments.Comments, nil
+}
+
+// Rewrites the whole comment file. Caller must hold the mutex.
+func (store *FileCommentStore) write(article_id string, comments []Comment) error {
+	bytes, err := json.MarshalIndent(Comments{comments}, "", "    ")
+	if nil != err {
+		return err
+	}
+
+	filename := store.filename(article_id)
+	if _, err = os.Stat(filename); os.IsNotExist(err) {
+		log.Println("Creating comment file for article: " + article_id)
+	}
+
+	// Write to a temporary file first such that readers never see
+	// a partially written file
+	temporary := filename + ".tmp"
+	err = ioutil.WriteFile(temporary, bytes, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary, filename)
+}
+
+func (store *FileCommentStore) Add(article_id string, comment Comment) (Comment, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	comments, err := store.List(article_id)
+	if err != nil {
+		return comment, err
+	}
+
+	if len(comment.Id) == 0 {
+		comment.Id = newCommentId()
+	}
+	comments = append(comments, comment)
+
+	return comment, store.write(article_id, comments)
+}
+
+func (store *FileCommentStore) Update(article_id string, comment Comment) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	comments, err := store.List(article_id)
+	if err != nil {
+		return err
+	}
+
+	for idx := range comments {
+		if comments[idx].Id == comment.Id {
+			comments[idx] = comment
+			return store.write(article_id, comments)
+		}
+	}
+	return ErrCommentNotFound
+}
+
+func (store *FileCommentStore) Delete(article_id string, comment_id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	comments, err := store.List(article_id)
+	if err != nil {
+		return err
+	}
+
+	for idx := range comments {
+		if comments[idx].Id == comment_id {
+			comments = append(comments[:idx], comments[idx+1:]...)
+			return store.write(article_id, comments)
+		}
+	}
+	return ErrCommentNotFound
+}
+
+func (store *FileCommentStore) Count(article_id string) (int, error) {
+	comments, err := store.List(article_id)
+	return len(comments), err
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	// Pure Go SQLite driver, registers itself as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultCommentDatabase = "/comments.db"
+)
+
+// Schema changes in order. Applied migrations are stored in the database,
+// new migrations must be added to the end.
+var commentMigrations = []string{
+	`CREATE TABLE comments (
+		id TEXT PRIMARY KEY,
+		article_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		body TEXT NOT NULL,
+		time_stamp TEXT NOT NULL
+	)`,
+	`CREATE INDEX comments_article_id ON comments (article_id, time_stamp)`,
+	// Existing comments were visible before moderation
+	`ALTER TABLE comments ADD COLUMN status TEXT NOT NULL DEFAULT 'approved'`,
+	`ALTER TABLE comments ADD COLUMN commenter_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE comments ADD COLUMN parent_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE comments ADD COLUMN by_admin INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE comments ADD COLUMN spam_reason TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE comments ADD COLUMN email TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE comments ADD COLUMN notify_replies INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE comments ADD COLUMN email_hash TEXT NOT NULL DEFAULT ''`,
+	// Revisions are stored as JSON, they are only read with the comment
+	`ALTER TABLE comments ADD COLUMN edited TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE comments ADD COLUMN revisions TEXT NOT NULL DEFAULT ''`,
+	// Text time stamps with varying number of fractional digits do not
+	// sort in time order, comments are ordered by the integer time
+	`ALTER TABLE comments ADD COLUMN time_unix_nano INTEGER NOT NULL DEFAULT 0`,
+	`UPDATE comments SET time_unix_nano =
+		CAST(ROUND((julianday(time_stamp) - 2440587.5) * 86400000) AS INTEGER) * 1000000`,
+	`DROP INDEX comments_article_id`,
+	`CREATE INDEX comments_article_time ON comments (article_id, time_unix_nano)`,
+	`ALTER TABLE comments ADD COLUMN spam_trained TEXT NOT NULL DEFAULT ''`,
+}
+
+// Stores comments in an SQLite database
+type SqliteCommentStore struct {
+	db *sql.DB
+}
+
+func getCommentDatabase() string {
+	if len(siteGlobal.CommentDatabase) > 0 {
+		return siteGlobal.CommentDatabase
+	}
+	return siteGlobal.ContentRoot + defaultCommentDatabase
+}
+
+func NewSqliteCommentStore(filename string) (*SqliteCommentStore, error) {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer, let database/sql do the waiting
+	db.SetMaxOpenConns(1)
+
+	store := &SqliteCommentStore{db}
+	err = store.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Applies migrations which have not yet been applied
+func (store *SqliteCommentStore) migrate() error {
+	_, err := store.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	version := 0
+	err = store.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(commentMigrations); version++ {
+		tx, err := store.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(commentMigrations[version]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Invalidates the articles when another process, such as the
+// import-comments command, changes the database. SQLite changes the data
+// version when other connections commit.
+func (store *SqliteCommentStore) Watch(articles *ArticleStore, interval time.Duration) {
+	version, err := store.dataVersion()
+	if err != nil {
+		log.Print("Could not watch comment database: " + err.Error())
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(interval)
+			new_version, err := store.dataVersion()
+			if err != nil {
+				log.Print("Failed to read comment database version: " + err.Error())
+				continue
+			}
+			if new_version != version {
+				version = new_version
+				articles.InvalidateAll()
+			}
+		}
+	}()
+}
+
+func (store *SqliteCommentStore) dataVersion() (int64, error) {
+	version := int64(0)
+	err := store.db.QueryRow(`PRAGMA data_version`).Scan(&version)
+	return version, err
+}
+
+func (store *SqliteCommentStore) Close() error {
+	return store.db.Close()
+}
+
+func formatCommentTime(t ParsableTime) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseCommentTime(value string) ParsableTime {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return ParsableTime{t}
+}
+
+// Stores the edit time and the revisions of the comment as columns
+func formatCommentEdits(comment Comment) (string, string, error) {
+	if !comment.IsEdited() {
+		return "", "", nil
+	}
+	revisions, err := json.Marshal(comment.Revisions)
+	return formatCommentTime(*comment.Edited), string(revisions), err
+}
+
+func parseCommentEdits(comment *Comment, edited string, revisions string) error {
+	if len(edited) == 0 {
+		return nil
+	}
+	edited_time := parseCommentTime(edited)
+	comment.Edited = &edited_time
+	return json.Unmarshal([]byte(revisions), &comment.Revisions)
+}
+
+// Comments without status are approved, the database always has a status
+func commentStatusOrApproved(comment Comment) string {
+	if len(comment.Status) == 0 {
+		return commentStatusApproved
+	}
+	return comment.Status
+}
+
+func (store *SqliteCommentStore) ArticleIds() ([]string, error) {
+	rows, err := store.db.Query(`SELECT DISTINCT article_id FROM comments ORDER BY article_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		id := ""
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (store *SqliteCommentStore) List(article_id string) ([]Comment, error) {
+	rows, err := store.db.Query(`SELECT id, name, body, time_stamp, status, commenter_id,
+		parent_id, by_admin, spam_reason, email, notify_replies, email_hash, edited, revisions,
+		spam_trained FROM comments WHERE article_id = ? ORDER BY time_unix_nano, rowid`, article_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		comment := Comment{}
+		time_stamp, edited, revisions := "", "", ""
+		err = rows.Scan(&comment.Id, &comment.Name, &comment.CommentBody, &time_stamp,
+			&comment.Status, &comment.CommenterId, &comment.ParentId, &comment.ByAdmin,
+			&comment.SpamReason, &comment.Email, &comment.NotifyReplies,
+			&comment.EmailHash, &edited, &revisions, &comment.SpamTrained)
+		if err != nil {
+			return nil, err
+		}
+		comment.TimeStamp = parseCommentTime(time_stamp)
+		if err = parseCommentEdits(&comment, edited, revisions); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func (store *SqliteCommentStore) Add(article_id string, comment Comment) (Comment, error) {
+	if len(comment.Id) == 0 {
+		comment.Id = newCommentId()
+	}
+	edited, revisions, err := formatCommentEdits(comment)
+	if err != nil {
+		return comment, err
+	}
+	_, err = store.db.Exec(`INSERT INTO comments (id, article_id, name, body, time_stamp, time_unix_nano,
+		status, commenter_id, parent_id, by_admin, spam_reason, email, notify_replies, email_hash,
+		edited, revisions, spam_trained) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		comment.Id, article_id, comment.Name, comment.CommentBody, formatCommentTime(comment.TimeStamp),
+		comment.TimeStamp.UnixNano(), commentStatusOrApproved(comment), comment.CommenterId, comment.ParentId, comment.ByAdmin,
+		comment.SpamReason, comment.Email, comment.NotifyReplies, comment.EmailHash, edited, revisions,
+		comment.SpamTrained)
+	return comment, err
+}
+
+func (store *SqliteCommentStore) Update(article_id string, comment Comment) error {
+	edited, revisions, err := formatCommentEdits(comment)
+	if err != nil {
+		return err
+	}
+	result, err := store.db.Exec(`UPDATE comments SET name = ?, body = ?, time_stamp = ?,
+		time_unix_nano = ?, status = ?, commenter_id = ?, parent_id = ?, by_admin = ?, spam_reason = ?,
+		email = ?, notify_replies = ?, email_hash = ?, edited = ?, revisions = ?, spam_trained = ?
+		WHERE id = ? AND article_id = ?`,
+		comment.Name, comment.CommentBody, formatCommentTime(comment.TimeStamp), comment.TimeStamp.UnixNano(),
+		commentStatusOrApproved(comment), comment.CommenterId, comment.ParentId, comment.ByAdmin,
+		comment.SpamReason, comment.Email, comment.NotifyReplies, comment.EmailHash, edited, revisions,
+		comment.SpamTrained, comment.Id, article_id)
+	return checkCommentFound(result, err)
+}
+
+func (store *SqliteCommentStore) Delete(article_id string, comment_id string) error {
+	result, err := store.db.Exec(`DELETE FROM comments WHERE id = ? AND article_id = ?`,
+		comment_id, article_id)
+	return checkCommentFound(result, err)
+}
+
+func (store *SqliteCommentStore) Count(article_id string) (int, error) {
+	count := 0
+	err := store.db.QueryRow(`SELECT COUNT(*) FROM comments WHERE article_id = ?`, article_id).Scan(&count)
+	return count, err
+}
+
+// Returns ErrCommentNotFound if the statement did not change any rows
+func checkCommentFound(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrCommentNotFound
+	}
+	return nil
+}
+
+// Command 'migrate-comments'. Imports comment files into the SQLite
+// database. Comments which already exist in the database are skipped, so
+// the command can be run multiple times.
+func migrateCommentsCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate-comments", flag.ExitOnError)
+	folder := flags.String("from", GetCommentFolder(), "Folder of the comment files")
+	database := flags.String("to", getCommentDatabase(), "SQLite database")
+	flags.Parse(args)
+
+	files := NewFileCommentStore(*folder)
+	db, err := NewSqliteCommentStore(*database)
+	if err != nil {
+		fmt.Println("Failed to open database: " + err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	article_ids, err := files.ArticleIds()
+	if err != nil {
+		fmt.Println("Failed to list comment files: " + err.Error())
+		return 1
+	}
+
+	num_imported := 0
+	num_skipped := 0
+	num_failed := 0
+	for _, article_id := range article_ids {
+		comments, err := files.List(article_id)
+		if err != nil {
+			fmt.Println(err.Error())
+			num_failed++
+			continue
+		}
+
+		existing, err := db.List(article_id)
+		if err != nil {
+			fmt.Println("Failed to read comments from database: " + err.Error())
+			return 1
+		}
+		existing_ids := make(map[string]bool)
+		for _, comment := range existing {
+			existing_ids[comment.Id] = true
+		}
+
+		for _, comment := range comments {
+			if existing_ids[comment.Id] {
+				num_skipped++
+				continue
+			}
+			if _, err = db.Add(article_id, comment); err != nil {
+				fmt.Println("Failed to import comment of article " + article_id + ": " + err.Error())
+				num_failed++
+				continue
+			}
+			num_imported++
+		}
+	}
+
+	fmt.Printf("Imported %d comments, skipped %d existing, %d failed\n", num_imported, num_skipped, num_failed)
+	if num_failed > 0 {
+		return 1
+	}
+	return 0
+}
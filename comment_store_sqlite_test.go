@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Skips the test when the SQLite driver is not linked in
+func requireSqlite(t *testing.T) {
+	t.Helper()
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite" {
+			return
+		}
+	}
+	t.Skip("SQLite driver is not available")
+}
+
+func newTestSqliteStore(t *testing.T, filename string) *SqliteCommentStore {
+	t.Helper()
+	store, err := NewSqliteCommentStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSqliteCommentStore(t *testing.T) {
+	requireSqlite(t)
+	store := newTestSqliteStore(t, filepath.Join(t.TempDir(), "comments.db"))
+
+	// Time stamps with and without fractional seconds
+	base := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	for idx, offset := range []time.Duration{0, 500 * time.Millisecond, 1500 * time.Millisecond, time.Second} {
+		comment := Comment{Name: "Reader", CommentBody: string(rune('a' + idx)),
+			TimeStamp: ParsableTime{base.Add(offset)}}
+		if _, err := store.Add("first", comment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	comments, err := store.List("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := ""
+	for _, comment := range comments {
+		order += comment.CommentBody
+	}
+	if order != "abdc" {
+		t.Errorf("Comments are in order '%s'", order)
+	}
+	if comments[0].Status != commentStatusApproved {
+		t.Errorf("Comment without status has status '%s'", comments[0].Status)
+	}
+
+	edited := ParsableTime{base.Add(time.Minute)}
+	comment := comments[1]
+	comment.Status = commentStatusRejected
+	comment.SpamTrained = spamTrainedSpam
+	comment.Edited = &edited
+	comment.Revisions = []CommentRevision{{"b", edited}}
+	comment.CommentBody = "edited"
+	if err = store.Update("first", comment); err != nil {
+		t.Fatal(err)
+	}
+	comments, err = store.List("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := comments[1]
+	if updated.CommentBody != "edited" || updated.Status != commentStatusRejected ||
+		updated.SpamTrained != spamTrainedSpam {
+		t.Errorf("Updated comment %+v", updated)
+	}
+	if !updated.IsEdited() || len(updated.Revisions) != 1 || updated.Revisions[0].CommentBody != "b" {
+		t.Errorf("Edits of the updated comment %+v", updated)
+	}
+
+	if err = store.Delete("first", comment.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Delete("first", comment.Id); err != ErrCommentNotFound {
+		t.Errorf("Deleting a missing comment returned %v", err)
+	}
+	if err = store.Update("first", comment); err != ErrCommentNotFound {
+		t.Errorf("Updating a missing comment returned %v", err)
+	}
+	if count, _ := store.Count("first"); count != 3 {
+		t.Errorf("Count is %d after delete", count)
+	}
+	if ids, _ := store.ArticleIds(); len(ids) != 1 || ids[0] != "first" {
+		t.Errorf("Article ids %v", ids)
+	}
+}
+
+// Comments stored before the integer time column are ordered by time
+// after the migration
+func TestSqliteMigrationBackfillsCommentTime(t *testing.T) {
+	requireSqlite(t)
+	filename := filepath.Join(t.TempDir(), "comments.db")
+
+	time_migration := -1
+	for idx, migration := range commentMigrations {
+		if strings.Contains(migration, "ADD COLUMN time_unix_nano") {
+			time_migration = idx
+		}
+	}
+	if time_migration < 0 {
+		t.Fatal("Migration of the time column not found")
+	}
+
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE schema_version (version INTEGER NOT NULL)`)
+	for _, migration := range commentMigrations[:time_migration] {
+		if err == nil {
+			_, err = db.Exec(migration)
+		}
+	}
+	if err == nil {
+		_, err = db.Exec(`INSERT INTO schema_version (version) VALUES (?)`, time_migration)
+	}
+	// Text order puts the fractional time first
+	for _, row := range [][]string{{"whole", "2020-01-01T10:00:00Z"}, {"fraction", "2020-01-01T10:00:00.5Z"}} {
+		if err == nil {
+			_, err = db.Exec(`INSERT INTO comments (id, article_id, name, body, time_stamp)
+				VALUES (?, 'first', 'Reader', ?, ?)`, row[0], row[0], row[1])
+		}
+	}
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newTestSqliteStore(t, filename)
+	comments, err := store.List("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[0].Id != "whole" || comments[1].Id != "fraction" {
+		t.Fatalf("Migrated comments %+v", comments)
+	}
+	if comments[1].TimeStamp.Sub(comments[0].TimeStamp.Time) != 500*time.Millisecond {
+		t.Errorf("Migrated times %v and %v", comments[0].TimeStamp, comments[1].TimeStamp)
+	}
+	if comments[0].SpamTrained != "" {
+		t.Errorf("Migrated comment has been trained as '%s'", comments[0].SpamTrained)
+	}
+}
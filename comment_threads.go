@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+const (
+	defaultMaxCommentDepth = 4
+)
+
+// Comment with its replies, used for rendering the comments as threads
+type CommentThread struct {
+	Comment
+	Replies []*CommentThread
+	// Zero for top level comments
+	Depth int
+	// Reply link is shown, static exports can not be commented
+	CanReply bool
+
+	parent *CommentThread
+}
+
+func maxCommentDepth() int {
+	if siteGlobal.MaxCommentDepth <= 0 {
+		return defaultMaxCommentDepth
+	}
+	return siteGlobal.MaxCommentDepth
+}
+
+// Builds threads from comments sorted oldest first. Replies which would be
+// nested deeper than the maximum depth are added to the deepest allowed
+// ancestor. Replies to comments which are not shown are shown on the top
+// level. Reply links are shown if 'can_reply' is set.
+func buildCommentThreads(comments []Comment, can_reply bool) []*CommentThread {
+	threads := []*CommentThread{}
+	by_id := make(map[string]*CommentThread)
+
+	for _, comment := range comments {
+		thread := &CommentThread{Comment: comment, CanReply: can_reply}
+		by_id[comment.Id] = thread
+
+		parent, found := by_id[comment.ParentId]
+		if len(comment.ParentId) == 0 || !found {
+			threads = append(threads, thread)
+			continue
+		}
+
+		for parent.Depth >= maxCommentDepth() && parent.parent != nil {
+			parent = parent.parent
+		}
+		thread.parent = parent
+		thread.Depth = parent.Depth + 1
+		parent.Replies = append(parent.Replies, thread)
+	}
+
+	return threads
+}
+
+// Returns true if replies to the comments of the article can be written
+func canReply(article *Article) bool {
+	return !staticExport && !article.AreCommentsClosed()
+}
+
+// Reads approved comments of the article and arranges them into threads.
+// If reading fails, the comments read earlier are kept and the error is
+// stored in the article.
+func loadComments(article *Article) error {
+	comments, err := GetComments(article.Id)
+	article.CommentsError = err
+	if err != nil {
+		if article.Comments == nil {
+			article.Comments = &[]Comment{}
+		}
+		return err
+	}
+	article.Comments = comments
+	article.CommentThreads = buildCommentThreads(*article.Comments, canReply(article))
+	return nil
+}
+
+// Returns the comment which is replied to in the request, or nil if the
+// request is not a reply. Only approved comments of the article can be
+// replied to.
+func getReplyTo(r *http.Request, article *Article) *Comment {
+	parent_id := r.FormValue("reply_to")
+	if len(parent_id) == 0 || article.Comments == nil {
+		return nil
+	}
+	for idx := range *article.Comments {
+		if (*article.Comments)[idx].Id == parent_id {
+			return &(*article.Comments)[idx]
+		}
+	}
+	log.Print("Reply to unknown comment: " + parent_id)
+	return nil
+}
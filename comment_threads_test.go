@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildCommentThreads(t *testing.T) {
+	old := siteGlobal
+	defer func() { siteGlobal = old }()
+	siteGlobal.MaxCommentDepth = 2
+
+	comments := []Comment{
+		{Id: "a"},
+		{Id: "b", ParentId: "a"},
+		{Id: "c", ParentId: "b"},
+		// Too deep, added to the deepest allowed ancestor
+		{Id: "d", ParentId: "c"},
+		// Parent is not shown
+		{Id: "e", ParentId: "missing"},
+		{Id: "f", ParentId: "a"},
+	}
+	threads := buildCommentThreads(comments, true)
+
+	if len(threads) != 2 || threads[0].Id != "a" || threads[1].Id != "e" {
+		t.Fatalf("Top level %v", threads)
+	}
+	a := threads[0]
+	if len(a.Replies) != 2 || a.Replies[0].Id != "b" || a.Replies[1].Id != "f" {
+		t.Fatalf("Replies of a %v", a.Replies)
+	}
+	b := a.Replies[0]
+	if len(b.Replies) != 2 || b.Replies[0].Id != "c" || b.Replies[1].Id != "d" {
+		t.Fatalf("Replies of b %v", b.Replies)
+	}
+	if b.Depth != 1 || b.Replies[0].Depth != 2 || b.Replies[1].Depth != 2 || threads[1].Depth != 0 {
+		t.Error("Wrong depths")
+	}
+	if !b.CanReply {
+		t.Error("Reply link is not shown")
+	}
+	if buildCommentThreads(comments, false)[0].CanReply {
+		t.Error("Reply link is shown when replies can not be written")
+	}
+}
+
+func TestGetReplyTo(t *testing.T) {
+	comments := []Comment{{Id: "a"}, {Id: "b"}}
+	article := &Article{Comments: &comments}
+
+	r := httptest.NewRequest("GET", "/article/first?reply_to=b", nil)
+	if reply_to := getReplyTo(r, article); reply_to == nil || reply_to.Id != "b" {
+		t.Errorf("Reply to %v", reply_to)
+	}
+	for _, query := range []string{"", "?reply_to=missing"} {
+		r = httptest.NewRequest("GET", "/article/first"+query, nil)
+		if reply_to := getReplyTo(r, article); reply_to != nil {
+			t.Errorf("Reply to %v with query '%s'", reply_to, query)
+		}
+	}
+}
+
+func TestCanReply(t *testing.T) {
+	old_global, old_export := siteGlobal, staticExport
+	defer func() { siteGlobal, staticExport = old_global, old_export }()
+
+	article := &Article{}
+	if !canReply(article) {
+		t.Error("Can not reply to an open article")
+	}
+	staticExport = true
+	if canReply(article) {
+		t.Error("Can reply in a static export")
+	}
+	staticExport = false
+	article.CommentsClosed = true
+	if canReply(article) {
+		t.Error("Can reply to an article with closed comments")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Renders the site into static files
+type Exporter struct {
+	OutputDir string
+
+	// Files written (or found unchanged) during this export, relative to
+	// the output directory
+	exported     map[string]bool
+	NumWritten   int
+	NumUnchanged int
+}
+
+const (
+	// List of exported files, used to remove files which are no longer
+	// exported
+	exportManifest = ".export_manifest"
+)
+
+// Last parts of routes without extension which are files instead of
+// pretty URL directories
+var exportFileRoutes = map[string]bool{
+	"rss": true,
+}
+
+// Set while exporting, pages are rendered without the parts which need
+// the server
+var staticExport = false
+
+func NewExporter(output_dir string) *Exporter {
+	exporter := new(Exporter)
+	exporter.OutputDir = output_dir
+	exporter.exported = make(map[string]bool)
+	return exporter
+}
+
+// Returns file of the route relative to the output directory. Pages are
+// written as 'index.html' in a directory named after the route.
+func exportFilename(route string) string {
+	if exportFileRoutes[path.Base(route)] || len(path.Ext(route)) > 0 {
+		return strings.TrimPrefix(route, "/")
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(route, "/")+"/index.html", "/")
+}
+
+// Writes the file only if the content has changed
+func (exporter *Exporter) writeFile(relative string, data []byte) error {
+	exporter.exported[relative] = true
+	filename := filepath.Join(exporter.OutputDir, relative)
+
+	old_data, err := ioutil.ReadFile(filename)
+	if err == nil && bytes.Equal(old_data, data) {
+		exporter.NumUnchanged++
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	exporter.NumWritten++
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// Copies the file if it is newer or different size than the exported one
+func (exporter *Exporter) copyFile(relative string, source string) error {
+	exporter.exported[relative] = true
+	filename := filepath.Join(exporter.OutputDir, relative)
+
+	source_info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(filename)
+	if err == nil && info.Size() == source_info.Size() &&
+		!info.ModTime().Before(source_info.ModTime()) {
+		exporter.NumUnchanged++
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		return err
+	}
+	exporter.NumWritten++
+	return os.Chtimes(filename, source_info.ModTime(), source_info.ModTime())
+}
+
+// Copies all files which are at least 'min_depth' directories deep.
+// Hidden directories, the output directory and private content such as
+// comments and mail are skipped.
+func (exporter *Exporter) copyTree(source_dir string, target_dir string, min_depth int) error {
+	if _, err := os.Stat(source_dir); os.IsNotExist(err) {
+		// Nothing to copy
+		return nil
+	}
+	output_dir, err := filepath.Abs(exporter.OutputDir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(source_dir, func(source string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			absolute, _ := filepath.Abs(source)
+			if absolute == output_dir || isPrivateContentPath(source) ||
+				(source != source_dir && strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isPrivateContentPath(source) {
+			return nil
+		}
+		relative, err := filepath.Rel(source_dir, source)
+		if err != nil {
+			return err
+		}
+		if strings.Count(filepath.ToSlash(relative), "/") < min_depth {
+			return nil
+		}
+		return exporter.copyFile(filepath.Join(target_dir, relative), source)
+	})
+}
+
+// Renders the route with the handler. Returns false if the route does not
+// exist (as for drafts).
+func (exporter *Exporter) exportRoute(handler http.HandlerFunc, route string) (bool, error) {
+	request_url := url.URL{Scheme: "http", Host: "localhost", Path: route}
+	r, err := http.NewRequest("GET", request_url.String(), nil)
+	if err != nil {
+		return false, err
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code == http.StatusNotFound {
+		return false, nil
+	}
+	if w.Code != http.StatusOK {
+		return false, fmt.Errorf("Route %s returned %d: %s", route, w.Code, w.Body.String())
+	}
+
+	return true, exporter.writeFile(exportFilename(route), w.Body.Bytes())
+}
+
+// Renders all pages of a paginated listing
+func (exporter *Exporter) exportPages(handler http.HandlerFunc, base string) error {
+	for page := 1; ; page++ {
+		found, err := exporter.exportRoute(handler, pageLink(base, page))
+		if err != nil {
+			return err
+		}
+		if !found {
+			return nil
+		}
+	}
+}
+
+func getAllTags(articles []*Article) []string {
+	found := make(map[string]bool)
+	tags := []string{}
+	for _, article := range articles {
+		for _, tag := range article.Tags {
+			// Same tag with different case has one page
+			if !found[normalizeTag(tag)] {
+				found[normalizeTag(tag)] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Renders every route of the server
+func (exporter *Exporter) exportRoutes() error {
+	// Dynamic parts are rendered read-only
+	staticExport = true
+
+	found, err := exporter.exportRoute(articlesHandler, "/")
+	if err == nil && !found {
+		err = fmt.Errorf("Front page not found")
+	}
+	if err != nil {
+		return err
+	}
+	if err = exporter.exportPages(articlesHandler, "/articles/"); err != nil {
+		return err
+	}
+
+	listed := GetAllArticles()
+	for _, tag := range getAllTags(listed) {
+		if !validTag.MatchString("/tag/" + tag) {
+			log.Print("Tag can not be exported as it has no valid URL: " + tag)
+			continue
+		}
+		if err = exporter.exportPages(tagHandler, "/tag/"+tag); err != nil {
+			return err
+		}
+		for _, feed_path := range feedPaths {
+			if _, err = exporter.exportRoute(tagHandler, "/tag/"+tag+"/"+feed_path); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Also unlisted articles, drafts are not found
+	series := make(map[string]bool)
+	avatars := make(map[string]bool)
+	for _, article := range articleStore.All() {
+		// Exporting would replace the comments of the earlier export
+		if article.CommentsError != nil {
+			return fmt.Errorf("Failed to read comments of article %s: %v", article.Id, article.CommentsError)
+		}
+		found, err := exporter.exportRoute(articleHandler, "/article/"+article.Id)
+		if err != nil {
+			return err
+		}
+		if found && article.IsListed() && len(article.Series.Id) > 0 {
+			series[article.Series.Id] = true
+		}
+		if found {
+			for _, comment := range *article.Comments {
+				avatars[comment.AvatarHash()] = true
+			}
+		}
+	}
+	for id := range series {
+		if _, err = exporter.exportRoute(seriesHandler, "/series/"+id); err != nil {
+			return err
+		}
+	}
+	// Avatars of the shown comments
+	for hash := range avatars {
+		if _, err = exporter.exportRoute(avatarHandler, avatarRoute+hash+".png"); err != nil {
+			return err
+		}
+	}
+
+	for route, handler := range map[string]http.HandlerFunc{
+		"/about/":      aboutHandler,
+		"/atom.xml":    atomHandler,
+		"/rss":         rssHandler,
+		"/feed.json":   jsonFeedHandler,
+		"/sitemap.xml": sitemapHandler,
+		"/robots.txt":  robotsHandler,
+	} {
+		if _, err = exporter.exportRoute(handler, route); err != nil {
+			return err
+		}
+	}
+	for part := 1; ; part++ {
+		route := "/sitemap/" + strconv.Itoa(part) + ".xml"
+		found, err := exporter.exportRoute(sitemapPartHandler, route)
+		if err != nil {
+			return err
+		}
+		if !found {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Removes files which were exported previously but not anymore
+func (exporter *Exporter) prune() error {
+	data, err := ioutil.ReadFile(filepath.Join(exporter.OutputDir, exportManifest))
+	if err != nil {
+		// First export
+		return nil
+	}
+	for _, relative := range strings.Split(string(data), "\n") {
+		if len(relative) == 0 || exporter.exported[relative] {
+			continue
+		}
+		err = os.Remove(filepath.Join(exporter.OutputDir, relative))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (exporter *Exporter) writeManifest() error {
+	files := []string{}
+	for relative := range exporter.exported {
+		files = append(files, relative)
+	}
+	sort.Strings(files)
+	return ioutil.WriteFile(filepath.Join(exporter.OutputDir, exportManifest),
+		[]byte(strings.Join(files, "\n")+"\n"), 0644)
+}
+
+func (exporter *Exporter) Run() error {
+	err := exporter.exportRoutes()
+	if err != nil {
+		return err
+	}
+
+	// Same files as served by fileserverHandlerStatic and
+	// fileserverHandlerContentStatic
+	err = exporter.copyTree(executablePath()+"/static", "static", 0)
+	if err != nil {
+		return err
+	}
+	err = exporter.copyTree(siteGlobal.ContentRoot, "content_static", 2)
+	if err != nil {
+		return err
+	}
+
+	err = exporter.prune()
+	if err != nil {
+		return err
+	}
+	return exporter.writeManifest()
+}
+
+// Command 'export'. Writes the site as static files.
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output_dir := flags.String("out", "export", "Output directory")
+	flags.Parse(args)
+
+	exporter := NewExporter(*output_dir)
+	err := exporter.Run()
+	if err != nil {
+		fmt.Println("Export failed: " + err.Error())
+		return 1
+	}
+
+	fmt.Println("Exported " + strconv.Itoa(exporter.NumWritten) + " changed files, " +
+		strconv.Itoa(exporter.NumUnchanged) + " unchanged files")
+	return 0
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportWritesCommentAvatars(t *testing.T) {
+	setupTestContent(t)
+	old_export := staticExport
+	defer func() { staticExport = old_export }()
+
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	comment, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Hello",
+		TimeStamp: ParsableTime{time.Now()}, Status: commentStatusApproved})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := t.TempDir()
+	if err = NewExporter(output).exportRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	avatar := filepath.Join(output, "avatar", comment.AvatarHash()+".png")
+	if _, err = os.Stat(avatar); err != nil {
+		t.Error("Avatar of the comment was not exported: " + err.Error())
+	}
+}
@@ -1,29 +1,161 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/gorilla/feeds"
+	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 )
 
-func getFeed() *feeds.Feed {
-	now := time.Now()
+const (
+	feedFormatAtom = "atom"
+	feedFormatRss  = "rss"
+	feedFormatJson = "json"
+
+	jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+	defaultFeedMaxItems = 20
+)
+
+// Link to a feed, added to the header for feed autodiscovery
+type FeedLink struct {
+	Href  string
+	Type  string
+	Title string
+}
+
+// JSON Feed 1.1, https://jsonfeed.org/version/1.1
+type JsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageUrl string           `json:"home_page_url,omitempty"`
+	FeedUrl     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Authors     []JsonFeedAuthor `json:"authors,omitempty"`
+	Items       []JsonFeedItem   `json:"items"`
+}
+
+type JsonFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	Url  string `json:"url,omitempty"`
+}
+
+type JsonFeedItem struct {
+	Id            string   `json:"id"`
+	Url           string   `json:"url,omitempty"`
+	Title         string   `json:"title,omitempty"`
+	ContentHtml   string   `json:"content_html,omitempty"`
+	ContentText   string   `json:"content_text,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	DatePublished string   `json:"date_published,omitempty"`
+	DateModified  string   `json:"date_modified,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// Paths of the feed formats relative to the page the feed is for
+var feedPaths = map[string]string{
+	feedFormatAtom: "atom.xml",
+	feedFormatRss:  "rss",
+	feedFormatJson: "feed.json",
+}
+
+var feedContentTypes = map[string]string{
+	feedFormatAtom: "application/atom+xml; charset=utf-8",
+	feedFormatRss:  "application/rss+xml; charset=utf-8",
+	feedFormatJson: "application/feed+json; charset=utf-8",
+}
+
+var validTagFeed = regexp.MustCompile("^/(tag)/([a-zA-Z0-9_ ]+)/(atom\\.xml|rss|feed\\.json)$")
+
+// Links and images in the article body
+var htmlUrlAttribute = regexp.MustCompile("(href|src)=\"([^\"]*)\"")
+
+func feedMaxItems() int {
+	if siteGlobal.FeedMaxItems <= 0 {
+		return defaultFeedMaxItems
+	}
+	return siteGlobal.FeedMaxItems
+}
+
+// Makes links and image paths of the HTML absolute, such that they work
+// in feed readers. Relative URLs are relative to the base URL.
+func absoluteUrls(html string, base string) string {
+	base_url, err := url.Parse(base)
+	if err != nil {
+		return html
+	}
+	return htmlUrlAttribute.ReplaceAllStringFunc(html, func(attribute string) string {
+		m := htmlUrlAttribute.FindStringSubmatch(attribute)
+		// Attribute value is HTML escaped
+		reference, err := url.Parse(strings.Replace(m[2], "&amp;", "&", -1))
+		if err != nil {
+			return attribute
+		}
+		absolute := base_url.ResolveReference(reference).String()
+		return m[1] + "=\"" + strings.Replace(absolute, "&", "&amp;", -1) + "\""
+	})
+}
+
+// Returns links to feeds of the site
+func getSiteFeedLinks() []FeedLink {
+	return []FeedLink{
+		{"/atom.xml", "application/atom+xml", "Sitewide ATOM Feed"},
+		{"/rss", "application/rss+xml", "Sitewide RSS Feed"},
+		{"/feed.json", "application/feed+json", "Sitewide JSON Feed"},
+	}
+}
+
+// Returns links to feeds of the site and of the tag
+func getTagFeedLinks(tag string) []FeedLink {
+	base := "/tag/" + url.PathEscape(tag) + "/"
+	links := getSiteFeedLinks()
+	links = append(links,
+		FeedLink{base + feedPaths[feedFormatAtom], "application/atom+xml", "ATOM Feed for tag " + tag},
+		FeedLink{base + feedPaths[feedFormatRss], "application/rss+xml", "RSS Feed for tag " + tag},
+		FeedLink{base + feedPaths[feedFormatJson], "application/feed+json", "JSON Feed for tag " + tag})
+	return links
+}
+
+// Returns feed of the newest articles. Items are in the same order as
+// articles, articles must be sorted newest first.
+func getArticlesFeed(title string, link string, articles []*Article) *feeds.Feed {
+	if len(articles) > feedMaxItems() {
+		articles = articles[:feedMaxItems()]
+	}
+
+	// Feed changes only when articles change, not on every request
+	updated := time.Time{}
+	for _, article := range articles {
+		if modified := articleLastModified(article); modified.After(updated) {
+			updated = modified
+		}
+	}
+
 	feed := &feeds.Feed{
-		Title:       websiteName(),
-		Link:        &feeds.Link{Href: websiteAddress()},
+		Title:       title,
+		Link:        &feeds.Link{Href: link},
 		Description: websiteDescription(),
-		Author:      &feeds.Author{websiteAuthor(), websiteEmail()},
-		Created:     now,
+		Author:      &feeds.Author{Name: websiteAuthor(), Email: websiteEmail()},
+		Created:     updated,
+		Updated:     updated,
 	}
 
-	articles := GetAllArticles()
 	for _, article := range articles {
 		item := &feeds.Item{
-			Title:       article.Title,
+			Title:       article.TitleWithSeries(),
 			Link:        &feeds.Link{Href: article.Link},
 			Description: article.Description,
 			Author:      feed.Author,
 			Created:     article.DateCreated.Time,
+			Updated:     articleLastModified(article),
+		}
+		if siteGlobal.FeedFullContent {
+			item.Content = absoluteUrls(string(article.Body), article.Link)
 		}
 		feed.Add(item)
 	}
@@ -31,24 +163,128 @@ func getFeed() *feeds.Feed {
 	return feed
 }
 
-func atomHandler(w http.ResponseWriter, r *http.Request) {
-	feed := getFeed()
-	atom, err := feed.ToAtom()
+func formatJsonFeedTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Converts feed of the articles to JSON Feed. JSON Feed also contains tags,
+// which is why articles are needed.
+func getJsonFeed(feed *feeds.Feed, feed_url string, articles []*Article) JsonFeed {
+	json_feed := JsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       feed.Title,
+		HomePageUrl: feed.Link.Href,
+		FeedUrl:     feed_url,
+		Description: feed.Description,
+		Authors:     []JsonFeedAuthor{{Name: feed.Author.Name, Url: websiteAddress()}},
+		Items:       []JsonFeedItem{},
+	}
+
+	for idx, item := range feed.Items {
+		json_item := JsonFeedItem{
+			Id:            item.Link.Href,
+			Url:           item.Link.Href,
+			Title:         item.Title,
+			ContentHtml:   item.Content,
+			ContentText:   item.Description,
+			Summary:       item.Description,
+			DatePublished: formatJsonFeedTime(item.Created),
+			DateModified:  formatJsonFeedTime(item.Updated),
+		}
+		if len(json_item.ContentHtml) > 0 {
+			// Description is in the summary
+			json_item.ContentText = ""
+		} else if len(json_item.ContentText) == 0 {
+			// Item must have content
+			json_item.ContentText = item.Title
+		}
+		if idx < len(articles) {
+			json_item.Tags = articles[idx].Tags
+		}
+		json_feed.Items = append(json_feed.Items, json_item)
+	}
+
+	return json_feed
+}
+
+// Writes the feed in the format. Path is the absolute path of the feed.
+func writeFeed(w http.ResponseWriter, feed *feeds.Feed, articles []*Article, format string, path string) {
+	data := ""
+	err := error(nil)
+	switch format {
+	case feedFormatAtom:
+		data, err = feed.ToAtom()
+	case feedFormatRss:
+		data, err = feed.ToRss()
+	case feedFormatJson:
+		bytes := []byte{}
+		bytes, err = json.MarshalIndent(getJsonFeed(feed, websiteAddress()+path, articles), "", "    ")
+		data = string(bytes)
+	default:
+		err = errors.New("Unknown feed format: " + format)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Write([]byte(atom))
+	w.Header().Set("Content-Type", feedContentTypes[format])
+	w.Write([]byte(data))
+}
+
+// Writes feed of all listed articles
+func writeSiteFeed(w http.ResponseWriter, format string, path string) {
+	articles := GetAllArticles()
+	feed := getArticlesFeed(websiteName(), websiteAddress(), articles)
+	writeFeed(w, feed, articles, format, path)
+}
+
+func atomHandler(w http.ResponseWriter, r *http.Request) {
+	writeSiteFeed(w, feedFormatAtom, "/atom.xml")
 }
 
 func rssHandler(w http.ResponseWriter, r *http.Request) {
-	feed := getFeed()
-	rss, err := feed.ToRss()
+	writeSiteFeed(w, feedFormatRss, "/rss")
+}
+
+func jsonFeedHandler(w http.ResponseWriter, r *http.Request) {
+	writeSiteFeed(w, feedFormatJson, "/feed.json")
+}
+
+// Returns tag and feed format of tag feed request
+func getTagFeed(r *http.Request) (string, string, error) {
+	m := validTagFeed.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		return "", "", errors.New("Invalid tag feed from request: " + r.URL.Path)
+	}
+
+	// The tag is the second subexpression and feed path the third
+	for format, path := range feedPaths {
+		if path == m[3] {
+			return m[2], format, nil
+		}
+	}
+	return "", "", errors.New("Unknown feed: " + m[3])
+}
+
+func tagFeedHandler(w http.ResponseWriter, r *http.Request) {
+	tag, format, err := getTagFeed(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.NotFound(w, r)
+		log.Print("Could not parse tag feed from request:" + err.Error())
+		return
+	}
+	articles, err := GetArticlesByTag(tag)
+	if err != nil || len(articles) == 0 {
+		http.NotFound(w, r)
 		return
 	}
 
-	w.Write([]byte(rss))
+	title := websiteName() + ": " + tag
+	link := websiteAddress() + "/tag/" + url.PathEscape(tag)
+	feed := getArticlesFeed(title, link, articles)
+	writeFeed(w, feed, articles, format, r.URL.EscapedPath())
 }
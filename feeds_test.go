@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func writeTestFeedArticles(t *testing.T) {
+	t.Helper()
+	siteGlobal.Address = "https://example.com"
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00",
+		"Description": "About edges", "Tags": ["opencv"]}`, "Body of the first")
+	writeTestArticle(t, "second", `{"Title": "Second", "DateCreated": "2020-01-02 10:00",
+		"Tags": ["cooking"]}`, "Body of the second")
+	writeTestArticle(t, "draft", `{"Title": "Draft", "DateCreated": "2020-01-03 10:00", "Status": "draft",
+		"Tags": ["opencv"]}`, "Body")
+}
+
+func getTestJsonFeed(t *testing.T, handler http.HandlerFunc, path string) JsonFeed {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status %d for %s", w.Code, path)
+	}
+	if content_type := w.Header().Get("Content-Type"); content_type != feedContentTypes[feedFormatJson] {
+		t.Errorf("Content type of %s is %s", path, content_type)
+	}
+	feed := JsonFeed{}
+	if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func TestJsonFeed(t *testing.T) {
+	setupTestContent(t)
+	writeTestFeedArticles(t)
+
+	feed := getTestJsonFeed(t, jsonFeedHandler, "/feed.json")
+	if feed.Version != jsonFeedVersion || feed.FeedUrl != "https://example.com/feed.json" {
+		t.Errorf("Feed %+v", feed)
+	}
+	if len(feed.Items) != 2 {
+		t.Fatalf("Feed has %d items", len(feed.Items))
+	}
+	newest := feed.Items[0]
+	if newest.Id != "https://example.com/article/second" || newest.Title != "Second" ||
+		len(newest.Tags) != 1 || newest.Tags[0] != "cooking" {
+		t.Errorf("Newest item %+v", newest)
+	}
+	// Item without description has its title as content
+	if newest.ContentText != "Second" || feed.Items[1].Summary != "About edges" {
+		t.Errorf("Item content %+v", feed.Items)
+	}
+	if !strings.HasPrefix(newest.DatePublished, "2020-01-02T10:00:00") {
+		t.Errorf("Item published %s", newest.DatePublished)
+	}
+}
+
+func TestTagFeeds(t *testing.T) {
+	setupTestContent(t)
+	writeTestFeedArticles(t)
+
+	feed := getTestJsonFeed(t, tagHandler, "/tag/opencv/feed.json")
+	if len(feed.Items) != 1 || feed.Items[0].Title != "First" {
+		t.Errorf("Tag feed items %+v", feed.Items)
+	}
+	if feed.HomePageUrl != "https://example.com/tag/opencv" || feed.FeedUrl != "https://example.com/tag/opencv/feed.json" {
+		t.Errorf("Tag feed links %s, %s", feed.HomePageUrl, feed.FeedUrl)
+	}
+
+	for path, format := range map[string]string{"/tag/opencv/atom.xml": feedFormatAtom, "/tag/opencv/rss": feedFormatRss} {
+		w := httptest.NewRecorder()
+		tagHandler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != feedContentTypes[format] {
+			t.Errorf("Status %d, type %s for %s", w.Code, w.Header().Get("Content-Type"), path)
+		}
+		if !strings.Contains(w.Body.String(), "/article/first") || strings.Contains(w.Body.String(), "/article/second") {
+			t.Errorf("Feed %s has wrong articles", path)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	tagHandler(w, httptest.NewRequest("GET", "/tag/missing/feed.json", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status %d for feed of an unknown tag", w.Code)
+	}
+}
+
+func TestTagPageLinksToTagFeeds(t *testing.T) {
+	links := getTagFeedLinks("computer vision")
+	found := false
+	for _, link := range links {
+		if link.Href == "/tag/computer%20vision/feed.json" && link.Type == "application/feed+json" {
+			found = true
+		}
+	}
+	if !found || len(links) != len(getSiteFeedLinks())+3 {
+		t.Errorf("Feed links %+v", links)
+	}
+}
+
+func TestAbsoluteUrls(t *testing.T) {
+	html := `<a href="/about/">a</a> <img src="images/x.png"> <a href="https://other.example/">b</a>` +
+		` <a href="?a=1&amp;b=2">c</a> <a href="#top">d</a>`
+	expected := `<a href="https://example.com/about/">a</a> <img src="https://example.com/article/images/x.png">` +
+		` <a href="https://other.example/">b</a> <a href="https://example.com/article/first?a=1&amp;b=2">c</a>` +
+		` <a href="https://example.com/article/first#top">d</a>`
+	if output := absoluteUrls(html, "https://example.com/article/first"); output != expected {
+		t.Errorf("Absolute URLs\n%s\nexpected\n%s", output, expected)
+	}
+}
+
+func TestFeedFullContentAndMaxItems(t *testing.T) {
+	setupTestContent(t)
+	writeTestFeedArticles(t)
+	writeTestArticle(t, "third", `{"Title": "Third", "DateCreated": "2020-01-04 10:00",
+		"DateModified": "2020-02-01 10:00"}`, "![Image](/content_static/images/third/x.png)")
+
+	siteGlobal.FeedMaxItems = 2
+	feed := getTestJsonFeed(t, jsonFeedHandler, "/feed.json")
+	if len(feed.Items) != 2 || feed.Items[0].Title != "Third" {
+		t.Fatalf("Limited feed items %+v", feed.Items)
+	}
+	if len(feed.Items[0].ContentHtml) > 0 {
+		t.Error("Feed has full content by default")
+	}
+	if !strings.HasPrefix(feed.Items[0].DateModified, "2020-02-01T10:00:00") {
+		t.Errorf("Item modified %s", feed.Items[0].DateModified)
+	}
+
+	siteGlobal.FeedFullContent = true
+	feed = getTestJsonFeed(t, jsonFeedHandler, "/feed.json")
+	if !strings.Contains(feed.Items[0].ContentHtml, `src="https://example.com/content_static/images/third/x.png"`) {
+		t.Errorf("Full content %s", feed.Items[0].ContentHtml)
+	}
+	if feed.Items[1].ContentText != "" || !strings.Contains(feed.Items[1].ContentHtml, "Body of the second") {
+		t.Errorf("Item with full content %+v", feed.Items[1])
+	}
+
+	// Feed time comes from the articles, the feed does not change between requests
+	atom := func() string {
+		w := httptest.NewRecorder()
+		atomHandler(w, httptest.NewRequest("GET", "/atom.xml", nil))
+		return w.Body.String()
+	}
+	first := atom()
+	if !strings.Contains(first, "<updated>2020-02-01T10:00:00") {
+		t.Errorf("Atom feed is not updated by the newest modification:\n%s", first)
+	}
+	if atom() != first {
+		t.Error("Feed changed between requests")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"path/filepath"
 	"strings"
 )
 
@@ -18,10 +19,46 @@ func noDirListing(h http.Handler) http.HandlerFunc {
 	})
 }
 
+// Returns files and folders which might be in the content root but must
+// not be served or exported
+func privateContentPaths() []string {
+	database := getCommentDatabase()
+	return []string{GetCommentFolder(), database, database + "-journal", database + "-wal",
+		database + "-shm", getSpamModelFilename(), getMailFolder(), getEmailHashKeyFile()}
+}
+
+// Returns true if the file is one of the private paths or inside one
+func isPrivateContentPath(filename string) bool {
+	absolute, err := filepath.Abs(filename)
+	if err != nil {
+		return true
+	}
+	for _, private := range privateContentPaths() {
+		private_absolute, err := filepath.Abs(private)
+		if err != nil {
+			continue
+		}
+		if absolute == private_absolute ||
+			strings.HasPrefix(absolute, private_absolute+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the file at the path under '/content_static/' can be
+// served, the file must be at 2nd sub directory or deeper
+func isServedContentStatic(file_path string) bool {
+	numSubfolders := strings.Count(file_path, "/")
+	if numSubfolders < 2 || strings.HasSuffix(file_path, "/") || len(file_path) == 0 {
+		return false
+	}
+	return !isPrivateContentPath(siteGlobal.ContentRoot + "/" + file_path)
+}
+
 func noDirListingMustBeIn2ndSubdir(h http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		numSubfolders := strings.Count(r.URL.Path, "/")
-		if numSubfolders < 2 || strings.HasSuffix(r.URL.Path, "/") || len(r.URL.Path) == 0 {
+		if !isServedContentStatic(r.URL.Path) {
 			http.NotFound(w, r)
 			return
 		}
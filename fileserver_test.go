@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrivateContentIsNotServedOrExported(t *testing.T) {
+	root := setupTestContent(t)
+	siteGlobal.MailFolder = filepath.Join(root, "mail")
+	files := []string{"images/first/deep.png", "mail/new/1.eml", "comments/old/first.txt"}
+	for _, name := range files {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !isServedContentStatic("images/first/deep.png") {
+		t.Error("Image is not served")
+	}
+	for _, name := range files[1:] {
+		if isServedContentStatic(name) {
+			t.Error("Private file is served: " + name)
+		}
+	}
+
+	output := t.TempDir()
+	if err := NewExporter(output).copyTree(root, "content_static", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(output, "content_static", files[0])); err != nil {
+		t.Error("Image was not exported: " + err.Error())
+	}
+	for _, name := range files[1:] {
+		if _, err := os.Stat(filepath.Join(output, "content_static", name)); err == nil {
+			t.Error("Private file was exported: " + name)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error in the article meta data
+type ArticleParseError struct {
+	// Filled by NewArticle
+	File string
+	// Line in the article file, 0 if unknown
+	Line int
+	// Meta data field, empty if unknown
+	Field string
+	Err   error
+}
+
+const (
+	metaSeparatorJson = "---------- META END ----------"
+	metaDelimiterYaml = "---"
+	metaDelimiterToml = "+++"
+)
+
+// Common names used by other static site generators and the
+// corresponding fields of Article
+var frontMatterAliases = map[string]string{
+	"date":    "DateCreated",
+	"lastmod": "DateModified",
+	"updated": "DateModified",
+	"summary": "Description",
+}
+
+var yamlErrorLine = regexp.MustCompile("line ([0-9]+)")
+
+func (err *ArticleParseError) Error() string {
+	location := err.File
+	if err.Line > 0 {
+		location += ":" + strconv.Itoa(err.Line)
+	}
+	if len(err.Field) > 0 {
+		location += ": field '" + err.Field + "'"
+	}
+	return location + ": " + err.Err.Error()
+}
+
+// Returns 1 based line number of the byte offset
+func lineOfOffset(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// Returns 1 based line number of the first line which sets the key, 0 if
+// not found. The whole key must match, 'tag' does not match 'tags:'.
+func lineOfKey(data []byte, key string) int {
+	for idx, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimLeft(line, " \t\"")
+		if len(line) < len(key) || !strings.EqualFold(line[:len(key)], key) {
+			continue
+		}
+		// Quote of a JSON key, then ':' in JSON and YAML or '=' in TOML
+		rest := strings.TrimLeft(line[len(key):], " \t\"")
+		if strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, "=") {
+			return idx + 1
+		}
+	}
+	return 0
+}
+
+// Splits article data into front matter and body. Front matter is either
+// JSON followed by a separator line, or YAML/TOML between delimiter lines.
+// Returns format of the front matter ("json", "yaml", "toml") and number of
+// lines before the front matter.
+func splitFrontMatter(data []byte) (format string, meta []byte, body []byte, line_offset int) {
+	text := string(data)
+	for _, delimiter := range []string{metaDelimiterYaml, metaDelimiterToml} {
+		if !strings.HasPrefix(text, delimiter+"\n") && !strings.HasPrefix(text, delimiter+"\r\n") {
+			continue
+		}
+		begin := strings.Index(text, "\n") + 1
+		end := strings.Index(text[begin:], "\n"+delimiter)
+		if end < 0 {
+			continue
+		}
+		end += begin
+		body_begin := end + 1 + len(delimiter)
+		if delimiter == metaDelimiterYaml {
+			format = "yaml"
+		} else {
+			format = "toml"
+		}
+		return format, data[begin:end], data[body_begin:], 1
+	}
+
+	// Find meta and body separator
+	separator_begin := strings.Index(text, metaSeparatorJson)
+	if separator_begin > 0 {
+		// Found separator, split the data into meta data and body data
+		return "json", data[:separator_begin-1], data[separator_begin+len(metaSeparatorJson):], 0
+	}
+
+	// Did not find separator, meta data is empty
+	return "json", []byte{}, data, 0
+}
+
+// Converts values decoded from YAML or TOML such that they can be
+// marshaled as JSON
+func toJsonCompatible(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{})
+		for key, inner := range value {
+			converted[fmt.Sprint(key)] = toJsonCompatible(inner)
+		}
+		return converted
+	case map[string]interface{}:
+		converted := make(map[string]interface{})
+		for key, inner := range value {
+			converted[key] = toJsonCompatible(inner)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for idx, inner := range value {
+			converted[idx] = toJsonCompatible(inner)
+		}
+		return converted
+	case time.Time:
+		return value.Format(timeFormat)
+	}
+	return value
+}
+
+// Converts YAML or TOML front matter to JSON meta data
+func frontMatterToJson(format string, meta []byte) ([]byte, error) {
+	var decoded interface{}
+	if format == "yaml" {
+		err := yaml.Unmarshal(meta, &decoded)
+		if err != nil {
+			line := 0
+			if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+				line, _ = strconv.Atoi(m[1])
+			}
+			return nil, &ArticleParseError{Line: line, Err: err}
+		}
+	} else {
+		values := make(map[string]interface{})
+		_, err := toml.Decode(string(meta), &values)
+		if err != nil {
+			line := 0
+			if parse_err, ok := err.(toml.ParseError); ok {
+				line = parse_err.Position.Line
+			}
+			return nil, &ArticleParseError{Line: line, Err: err}
+		}
+		decoded = values
+	}
+
+	if decoded == nil {
+		// Empty front matter
+		return []byte{}, nil
+	}
+	values, ok := toJsonCompatible(decoded).(map[string]interface{})
+	if !ok {
+		return nil, &ArticleParseError{Line: 1, Err: errors.New("Front matter is not a mapping")}
+	}
+
+	for key, value := range values {
+		field, found := frontMatterAliases[strings.ToLower(key)]
+		if !found {
+			continue
+		}
+		delete(values, key)
+		values[field] = value
+	}
+	if draft, ok := values["draft"].(bool); ok && draft {
+		values["Status"] = articleStatusDraft
+	}
+
+	return json.Marshal(values)
+}
+
+// Finds out which field of the JSON meta data fails to parse
+func findFailingField(meta_json []byte) string {
+	values := make(map[string]json.RawMessage)
+	if json.Unmarshal(meta_json, &values) != nil {
+		return ""
+	}
+	for key, value := range values {
+		single := map[string]json.RawMessage{key: value}
+		single_json, _ := json.Marshal(single)
+		if json.Unmarshal(single_json, new(Article)) != nil {
+			return key
+		}
+	}
+	return ""
+}
+
+// Parses meta data of any supported format into the article
+func parseArticleMeta(format string, meta []byte, line_offset int, article *Article) error {
+	if len(bytes.TrimSpace(meta)) == 0 {
+		return nil
+	}
+
+	meta_json := meta
+	if format != "json" {
+		var err error
+		meta_json, err = frontMatterToJson(format, meta)
+		if err != nil {
+			if parse_err, ok := err.(*ArticleParseError); ok && parse_err.Line > 0 {
+				parse_err.Line += line_offset
+			}
+			return err
+		}
+		if len(meta_json) == 0 {
+			return nil
+		}
+	}
+
+	err := json.Unmarshal(meta_json, article)
+	if err == nil {
+		return nil
+	}
+
+	parse_err := &ArticleParseError{Err: err}
+	switch json_err := err.(type) {
+	case *json.SyntaxError:
+		// Offset is only meaningful in the original JSON
+		if format == "json" {
+			parse_err.Line = lineOfOffset(meta, json_err.Offset)
+		}
+		return parse_err
+	case *json.UnmarshalTypeError:
+		parse_err.Field = json_err.Field
+	}
+	if len(parse_err.Field) == 0 {
+		parse_err.Field = findFailingField(meta_json)
+	}
+	if len(parse_err.Field) > 0 {
+		// Nested fields are found with the innermost name and aliased
+		// fields with their original name
+		path := strings.Split(parse_err.Field, ".")
+		key := path[len(path)-1]
+		for alias, field := range frontMatterAliases {
+			if field == key && lineOfKey(meta, alias) > 0 {
+				key = alias
+			}
+		}
+		if line := lineOfKey(meta, key); line > 0 {
+			parse_err.Line = line + line_offset
+		}
+	}
+
+	return parse_err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func parseTestArticle(t *testing.T, data string) (*Article, error) {
+	t.Helper()
+	article := new(Article)
+	err := parseRawTextArticleData([]byte(data), article)
+	return article, err
+}
+
+func TestFrontMatterFormats(t *testing.T) {
+	articles := map[string]string{
+		"json": `{"Title": "Title", "DateCreated": "2020-01-02 10:00", "Tags": ["go", "web"]}
+` + metaSeparatorJson + `
+Body text`,
+		"yaml": `---
+title: Title
+date: 2020-01-02T10:00:00Z
+tags: [go, web]
+---
+Body text`,
+		"toml": `+++
+title = "Title"
+date = 2020-01-02T10:00:00Z
+tags = ["go", "web"]
++++
+Body text`,
+	}
+	for format, data := range articles {
+		article, err := parseTestArticle(t, data)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if article.Title != "Title" || article.DateCreated.Format(timeFormat) != "2020-01-02 10:00" ||
+			strings.Join(article.Tags, ",") != "go,web" {
+			t.Errorf("%s: parsed '%s' %v %v", format, article.Title, article.DateCreated, article.Tags)
+		}
+		if !strings.Contains(string(article.Body), "Body text") || strings.Contains(string(article.Body), "title") {
+			t.Errorf("%s: body is '%s'", format, article.Body)
+		}
+	}
+}
+
+func TestFrontMatterAliasesAndDraft(t *testing.T) {
+	article, err := parseTestArticle(t, `---
+title: Draft
+summary: Short
+lastmod: 2020-02-01
+draft: true
+---
+Body`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Description != "Short" || article.DateModified.Format("2006-01-02") != "2020-02-01" {
+		t.Errorf("Aliases were not applied: '%s' %v", article.Description, article.DateModified)
+	}
+	if article.Status != articleStatusDraft {
+		t.Errorf("Status is '%s'", article.Status)
+	}
+}
+
+func TestFrontMatterErrorLines(t *testing.T) {
+	tests := []struct {
+		data  string
+		line  int
+		field string
+	}{
+		// Line numbers include the opening delimiter
+		{"---\ntitle: Title\ndate: tomorrow\n---\nBody", 3, "DateCreated"},
+		{"+++\ntitle = \"Title\"\ntags = 5\n+++\nBody", 3, "tags"},
+		{"{\"Title\": \"Title\",\n\"Tags\": [\"a\",]}\n" + metaSeparatorJson + "\nBody", 2, ""},
+	}
+	for _, test := range tests {
+		_, err := parseTestArticle(t, test.data)
+		parse_err, ok := err.(*ArticleParseError)
+		if !ok {
+			t.Errorf("No parse error for %q: %v", test.data, err)
+			continue
+		}
+		if parse_err.Line != test.line || !strings.EqualFold(parse_err.Field, test.field) {
+			t.Errorf("Error of %q at line %d field '%s': %v", test.data, parse_err.Line, parse_err.Field, parse_err)
+		}
+	}
+}
+
+func TestLineOfKeyMatchesWholeKey(t *testing.T) {
+	tests := []struct {
+		meta string
+		key  string
+		line int
+	}{
+		{"tags: [a]\ntag: b", "tag", 2},
+		{"tags: [a]\ntag: b", "tags", 1},
+		{"{\n    \"Tags\": [\"a\"],\n    \"Tag\" : \"b\"\n}", "tag", 3},
+		{"tags = [\"a\"]\ntag = \"b\"", "Tag", 2},
+		{"tags: [a]", "tag", 0},
+		{"title: tag: in the value", "tag", 0},
+	}
+	for _, test := range tests {
+		if line := lineOfKey([]byte(test.meta), test.key); line != test.line {
+			t.Errorf("Key '%s' found from line %d of %q, expected %d", test.key, line, test.meta, test.line)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"code.google.com/p/gorilla/securecookie"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Points the site to an empty content root in a temporary folder, with
+// file comment storage, an empty article store and the default spam rules
+// with an untrained classifier. Returns the content root.
+func setupTestContent(t *testing.T) string {
+	t.Helper()
+	old_global := siteGlobal
+	old_store := articleStore
+	old_comments := commentStore
+	old_classifier := spamClassifier
+	old_rules := spamRules
+	t.Cleanup(func() {
+		siteGlobal = old_global
+		articleStore = old_store
+		commentStore = old_comments
+		spamClassifier = old_classifier
+		spamRules = old_rules
+	})
+
+	root := t.TempDir()
+	siteGlobal = SiteGlobal{}
+	siteGlobal.ContentRoot = root
+	for _, folder := range []string{GetArticleFolder(), GetCommentFolder()} {
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	articleStore = NewArticleStore()
+	commentStore = NewFileCommentStore(GetCommentFolder())
+	if err := initSpamFilter(); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// Writes an article file with JSON meta data
+func writeTestArticle(t *testing.T, id string, meta string, body string) {
+	t.Helper()
+	data := meta + "\n" + metaSeparatorJson + "\n" + body
+	filename := filepath.Join(GetArticleFolder(), id+articleExtension)
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Sets cookie keys which are normally read from the auth config
+func setupTestCookies(t *testing.T) {
+	t.Helper()
+	old_auth, old_encr := cookieAuthKey, cookieEncrKey
+	old_secure, old_permanent := secureCookie, permanentCookie
+	t.Cleanup(func() {
+		cookieAuthKey, cookieEncrKey = old_auth, old_encr
+		secureCookie, permanentCookie = old_secure, old_permanent
+	})
+
+	cookieAuthKey = bytes.Repeat([]byte{1}, 32)
+	cookieEncrKey = bytes.Repeat([]byte{2}, 32)
+	secureCookie = securecookie.New(cookieAuthKey, cookieEncrKey)
+	permanentCookie = securecookie.New(cookieAuthKey, cookieEncrKey).MaxAge(0)
+}
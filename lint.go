@@ -0,0 +1,270 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+type lintIssue struct {
+	File     string
+	Line     int
+	Severity string
+	Message  string
+}
+
+// Collects problems found from the content
+type Linter struct {
+	Issues      []lintIssue
+	NumErrors   int
+	NumWarnings int
+}
+
+var (
+	htmlImage          = regexp.MustCompile("<img[^>]*>")
+	htmlAltAttribute   = regexp.MustCompile("alt=\"([^\"]*)\"")
+	htmlIdAttribute    = regexp.MustCompile("\\sid=\"([^\"]*)\"")
+	contentStaticLink  = regexp.MustCompile("(?:src|href)=\"(/content_static/[^\"#?]*)")
+	markdownImageOrUrl = regexp.MustCompile("/content_static/[^\\s)\"'#?]*")
+)
+
+func (linter *Linter) add(severity string, file string, line int, message string) {
+	linter.Issues = append(linter.Issues, lintIssue{file, line, severity, message})
+	if severity == lintError {
+		linter.NumErrors++
+	} else {
+		linter.NumWarnings++
+	}
+}
+
+func (linter *Linter) Error(file string, message string) {
+	linter.add(lintError, file, 0, message)
+}
+
+func (linter *Linter) Warning(file string, message string) {
+	linter.add(lintWarning, file, 0, message)
+}
+
+func (linter *Linter) Print() {
+	for _, issue := range linter.Issues {
+		location := issue.File
+		if issue.Line > 0 {
+			location += ":" + strconv.Itoa(issue.Line)
+		}
+		fmt.Println(location + ": " + issue.Severity + ": " + issue.Message)
+	}
+	fmt.Printf("%d errors, %d warnings\n", linter.NumErrors, linter.NumWarnings)
+}
+
+// Returns true if path under '/content_static/' points to an existing file
+func contentStaticExists(url string) bool {
+	file_path := strings.TrimPrefix(url, "/content_static/")
+	// File which exists but is not served is missing from the site
+	if !isServedContentStatic(file_path) {
+		return false
+	}
+	filename := siteGlobal.ContentRoot + "/" + file_path
+	info, err := os.Stat(filename)
+	return err == nil && !info.IsDir()
+}
+
+// Returns line of the first occurrence of the text in the file, 0 if not found
+func lineOfText(data []byte, text string) int {
+	idx := strings.Index(string(data), text)
+	if idx < 0 {
+		return 0
+	}
+	return lineOfOffset(data, int64(idx))
+}
+
+func (linter *Linter) lintArticle(id string) {
+	filename := GetArticleFolder() + "/" + id + articleExtension
+	data, _ := ioutil.ReadFile(filename)
+
+	// Same code path as the server uses
+	article, err := NewArticle(id)
+	if err != nil {
+		if parse_err, ok := err.(*ArticleParseError); ok {
+			message := parse_err.Err.Error()
+			if len(parse_err.Field) > 0 {
+				message = "Field '" + parse_err.Field + "': " + message
+			}
+			linter.add(lintError, filename, parse_err.Line, message)
+		} else {
+			linter.Error(filename, err.Error())
+		}
+		// Rest of the checks would only report consequences of the error
+		return
+	}
+
+	if len(strings.TrimSpace(article.Title)) == 0 {
+		linter.Error(filename, "Missing Title")
+	}
+	if article.DateCreated.IsZero() {
+		linter.Error(filename, "Missing DateCreated")
+	}
+	if !article.DateModified.IsZero() && article.DateModified.Before(article.DateCreated.Time) {
+		linter.Warning(filename, "DateModified is before DateCreated")
+	}
+
+	switch article.Status {
+	case "", articleStatusDraft, articleStatusUnlisted, articleStatusPublished:
+	case articleStatusScheduled:
+		if article.PublishAt.IsZero() {
+			linter.Error(filename, "Scheduled article without PublishAt")
+		}
+	default:
+		linter.Error(filename, "Unknown Status '"+article.Status+"'")
+	}
+
+	if len(siteGlobal.KnownTags) > 0 {
+		for _, tag := range article.Tags {
+			if !hasTag(siteGlobal.KnownTags, tag) {
+				linter.Error(filename, "Unknown tag '"+tag+"'")
+			}
+		}
+	}
+
+	if len(article.Series.Id) > 0 && article.Series.Part <= 0 {
+		linter.Warning(filename, "Series without Part")
+	}
+
+	// Each missing file is reported only once
+	reported := make(map[string]bool)
+
+	if len(article.Icon) == 0 {
+		linter.Warning(filename, "Missing Icon")
+	} else if strings.HasPrefix(article.Icon, "/content_static/") && !contentStaticExists(article.Icon) {
+		linter.Error(filename, "Icon file does not exist: "+article.Icon)
+		reported[article.Icon] = true
+	}
+
+	body := string(article.Body)
+	for _, image := range htmlImage.FindAllString(body, -1) {
+		m := htmlAltAttribute.FindStringSubmatch(image)
+		if m == nil || len(strings.TrimSpace(m[1])) == 0 {
+			linter.Warning(filename, "Image without alt text: "+image)
+		}
+	}
+
+	for _, m := range contentStaticLink.FindAllStringSubmatch(body, -1) {
+		url := m[1]
+		if !reported[url] && !contentStaticExists(url) {
+			reported[url] = true
+			linter.add(lintError, filename, lineOfText(data, url), "Referenced file does not exist: "+url)
+		}
+	}
+	// Links in raw HTML or reference definitions are not always in the
+	// rendered body
+	for _, url := range markdownImageOrUrl.FindAllString(string(data), -1) {
+		if !reported[url] && !contentStaticExists(url) {
+			reported[url] = true
+			linter.add(lintError, filename, lineOfText(data, url), "Referenced file does not exist: "+url)
+		}
+	}
+
+	element_ids := make(map[string]bool)
+	for _, m := range htmlIdAttribute.FindAllStringSubmatch(body, -1) {
+		if element_ids[m[1]] {
+			linter.Warning(filename, "Duplicate element id '"+m[1]+"'")
+		}
+		element_ids[m[1]] = true
+	}
+}
+
+func (linter *Linter) lintComments(article_ids []string) {
+	files, err := ioutil.ReadDir(GetCommentFolder())
+	if err != nil {
+		// No comments
+		return
+	}
+
+	for _, file := range files {
+		ext := path.Ext(file.Name())
+		if ext != commentExtension {
+			continue
+		}
+		id := strings.TrimSuffix(file.Name(), ext)
+		filename := GetCommentFilename(id)
+
+		if !stringInSlice(id, article_ids) {
+			linter.Warning(filename, "Comments for unknown article '"+id+"'")
+		}
+
+		// Comment files are linted even if the site uses another storage
+		comments, err := NewFileCommentStore(GetCommentFolder()).List(id)
+		if err != nil {
+			linter.Error(filename, "Failed to parse comments: "+err.Error())
+			continue
+		}
+		comment_ids := make(map[string]bool)
+		for _, comment := range comments {
+			comment_ids[comment.Id] = true
+		}
+		for idx, comment := range comments {
+			position := "Comment " + strconv.Itoa(idx+1)
+			if len(strings.TrimSpace(comment.Name)) == 0 {
+				linter.Warning(filename, position+" without name")
+			}
+			if len(strings.TrimSpace(comment.CommentBody)) == 0 {
+				linter.Warning(filename, position+" without body")
+			}
+			if comment.TimeStamp.IsZero() {
+				linter.Error(filename, position+" without valid TimeStamp")
+			}
+			switch comment.Status {
+			case "", commentStatusPending, commentStatusApproved, commentStatusRejected, commentStatusDeleted:
+			default:
+				linter.Error(filename, position+" has unknown status '"+comment.Status+"'")
+			}
+			if len(comment.ParentId) > 0 && !comment_ids[comment.ParentId] {
+				linter.Warning(filename, position+" replies to unknown comment '"+comment.ParentId+"'")
+			}
+		}
+	}
+}
+
+// Parses all articles and comments and reports problems
+func (linter *Linter) Run() {
+	ids := getAllArticleIds()
+
+	lower_ids := make(map[string]string)
+	for _, id := range ids {
+		lower := strings.ToLower(id)
+		if other, found := lower_ids[lower]; found {
+			linter.Error(GetArticleFolder()+"/"+id+articleExtension,
+				"Duplicate article id, differs only by case from '"+other+"'")
+		}
+		lower_ids[lower] = id
+
+		linter.lintArticle(id)
+	}
+
+	linter.lintComments(ids)
+}
+
+// Command 'lint'. Returns non-zero if errors were found.
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "Treat warnings as errors")
+	flags.Parse(args)
+
+	linter := new(Linter)
+	linter.Run()
+	linter.Print()
+
+	if linter.NumErrors > 0 || (*strict && linter.NumWarnings > 0) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContentStaticExistsRequiresServedPath(t *testing.T) {
+	root := setupTestContent(t)
+	if err := os.MkdirAll(filepath.Join(root, "images", "first"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"top.png", "images/shallow.png", "images/first/deep.png"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !contentStaticExists("/content_static/images/first/deep.png") {
+		t.Error("Served file was reported missing")
+	}
+	for _, url := range []string{"/content_static/top.png", "/content_static/images/shallow.png",
+		"/content_static/images/first/", "/content_static/images/first/missing.png"} {
+		if contentStaticExists(url) {
+			t.Error("File which is not served was reported to exist: " + url)
+		}
+	}
+}
+
+func TestLintCommentStatuses(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	for _, status := range []string{"", commentStatusApproved, commentStatusPending, commentStatusRejected} {
+		_, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Hello",
+			TimeStamp: ParsableTime{time.Now()}, Status: status})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, err := commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Oops",
+		TimeStamp: ParsableTime{time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = deleteOwnComment("first", deleted.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	linter := Linter{}
+	linter.lintComments([]string{"first"})
+	if linter.NumErrors != 0 || linter.NumWarnings != 0 {
+		t.Errorf("Known statuses were reported: %+v", linter.Issues)
+	}
+
+	_, err = commentStore.Add("first", Comment{Name: "Reader", CommentBody: "Hello",
+		TimeStamp: ParsableTime{time.Now()}, Status: "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	linter = Linter{}
+	linter.lintComments([]string{"first"})
+	if linter.NumErrors != 1 {
+		t.Errorf("Unknown status was not reported: %+v", linter.Issues)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mailerSmtp = "smtp"
+	mailerFile = "file"
+
+	defaultSmtpPort = 587
+)
+
+type Mail struct {
+	To      []string
+	Subject string
+	// Plain text body
+	Body string
+	// Additional headers, e.g. List-Unsubscribe
+	Headers map[string]string
+}
+
+// Sends email
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// Set by initMailer, nil if sending email is not configured
+var mailer Mailer
+
+// Sends email through an SMTP server
+type SmtpMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Writes email to a maildir instead of sending, used for testing. Each mail
+// is a file in the 'new' folder.
+type FileMailer struct {
+	Folder string
+	From   string
+}
+
+// Returns folder of the file mailer. By default the mail is written next
+// to the executable, outside of the content root, such that the mail is
+// never served or exported with the content.
+func getMailFolder() string {
+	if len(siteGlobal.MailFolder) > 0 {
+		return siteGlobal.MailFolder
+	}
+	return executablePath() + "/mail"
+}
+
+// Creates the mailer selected in the site config
+func initMailer() error {
+	from := siteGlobal.MailFrom
+	if len(from) == 0 {
+		from = websiteEmail()
+	}
+
+	switch siteGlobal.Mailer {
+	case "":
+		mailer = nil
+	case mailerSmtp:
+		port := siteGlobal.SmtpPort
+		if port <= 0 {
+			port = defaultSmtpPort
+		}
+		mailer = &SmtpMailer{siteGlobal.SmtpHost, port, siteGlobal.SmtpUsername, siteGlobal.SmtpPassword, from}
+	case mailerFile:
+		mailer = &FileMailer{getMailFolder(), from}
+	default:
+		return errors.New("Unknown mailer: " + siteGlobal.Mailer)
+	}
+	return nil
+}
+
+// Formats the mail as an RFC 5322 message
+func formatMail(from string, mail Mail) []byte {
+	var message bytes.Buffer
+	header := func(name string, value string) {
+		// Header injection is not possible even if a value comes from a user
+		value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+		message.WriteString(name + ": " + value + "\r\n")
+	}
+
+	header("From", from)
+	header("To", strings.Join(mail.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", mail.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-Id", "<"+newCommentId()+"@"+mailDomain(from)+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	for name, value := range mail.Headers {
+		header(name, value)
+	}
+	message.WriteString("\r\n")
+	message.WriteString(strings.Replace(mail.Body, "\n", "\r\n", -1))
+	return message.Bytes()
+}
+
+func mailDomain(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "localhost"
+	}
+	return strings.Trim(address[at+1:], "> ")
+}
+
+func (mailer *SmtpMailer) Send(mail Mail) error {
+	auth := smtp.Auth(nil)
+	if len(mailer.Username) > 0 {
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, mailer.Host)
+	}
+	address := mailer.Host + ":" + strconv.Itoa(mailer.Port)
+	return smtp.SendMail(address, auth, mailer.From, mail.To, formatMail(mailer.From, mail))
+}
+
+func (mailer *FileMailer) Send(mail Mail) error {
+	for _, folder := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(mailer.Folder, folder), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Maildir delivery, written to 'tmp' and moved to 'new' when complete
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + newCommentId() + ".buq2"
+	temporary := filepath.Join(mailer.Folder, "tmp", name)
+	err := ioutil.WriteFile(temporary, formatMail(mailer.From, mail), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary, filepath.Join(mailer.Folder, "new", name))
+}
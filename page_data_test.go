@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPageDataIsNotSharedByCachedArticles(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+
+	cached, err := articleStore.Get("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	article := new(Article)
+	*article = *cached
+	article.PageData = newPageData()
+	article.Pagination.Next = "/article/second"
+
+	if len(cached.Pagination.Next) > 0 {
+		t.Error("Pagination of the page was stored to the cached article")
+	}
+	if len(article.Feeds) == 0 {
+		t.Error("Page has no feeds")
+	}
+}
+
+func TestPageDataStaticExport(t *testing.T) {
+	old := staticExport
+	defer func() { staticExport = old }()
+
+	staticExport = true
+	if !newPageData().StaticExport {
+		t.Error("Page of static export is not marked as static")
+	}
+	staticExport = false
+	if newPageData().StaticExport {
+		t.Error("Page is marked as static")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type Pagination struct {
+	// Links to previous and next pages, empty if there is no such page
+	Prev string
+	Next string
+}
+
+const (
+	defaultArticlesPerPage = 10
+)
+
+func articlesPerPage() int {
+	if siteGlobal.ArticlesPerPage <= 0 {
+		return defaultArticlesPerPage
+	}
+	return siteGlobal.ArticlesPerPage
+}
+
+// Returns URL of the page. First page does not have page number in the URL
+func pageLink(base string, page int) string {
+	if page <= 1 {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/page/" + strconv.Itoa(page)
+}
+
+// Parses page number from the regexp submatch. Empty match is the first page
+func parsePageNumber(match string) (int, error) {
+	if len(match) == 0 {
+		return 1, nil
+	}
+	return strconv.Atoi(match)
+}
+
+// Returns articles of the page (first page is 1) and links to the
+// neighbouring pages. Returns error if the page is out of range.
+func paginateArticles(articles []*Article, page int, base string) ([]*Article, Pagination, error) {
+	pagination := Pagination{}
+	per_page := articlesPerPage()
+	num_pages := (len(articles) + per_page - 1) / per_page
+
+	// First page always exists, even if there are no articles
+	if page < 1 || (page > num_pages && page != 1) {
+		return nil, pagination, errors.New("Page out of range: " + strconv.Itoa(page))
+	}
+
+	begin := (page - 1) * per_page
+	end := begin + per_page
+	if end > len(articles) {
+		end = len(articles)
+	}
+
+	if page > 1 {
+		pagination.Prev = pageLink(base, page-1)
+	}
+	if page < num_pages {
+		pagination.Next = pageLink(base, page+1)
+	}
+
+	return articles[begin:end], pagination, nil
+}
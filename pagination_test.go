@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPaginateArticles(t *testing.T) {
+	old := siteGlobal
+	defer func() { siteGlobal = old }()
+	siteGlobal.ArticlesPerPage = 2
+
+	articles := make([]*Article, 5)
+	for idx := range articles {
+		articles[idx] = &Article{Id: strconv.Itoa(idx)}
+	}
+
+	tests := []struct {
+		page  int
+		first string
+		count int
+		prev  string
+		next  string
+	}{
+		{1, "0", 2, "", "/tag/go/page/2"},
+		{2, "2", 2, "/tag/go", "/tag/go/page/3"},
+		{3, "4", 1, "/tag/go/page/2", ""},
+	}
+	for _, test := range tests {
+		page, pagination, err := paginateArticles(articles, test.page, "/tag/go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != test.count || page[0].Id != test.first {
+			t.Errorf("Page %d has %d articles starting from %s", test.page, len(page), page[0].Id)
+		}
+		if pagination.Prev != test.prev || pagination.Next != test.next {
+			t.Errorf("Page %d links to %+v", test.page, pagination)
+		}
+	}
+
+	for _, page := range []int{0, -1, 4} {
+		if _, _, err := paginateArticles(articles, page, "/tag/go"); err == nil {
+			t.Errorf("Page %d was returned", page)
+		}
+	}
+
+	// First page exists without articles
+	page, pagination, err := paginateArticles(nil, 1, "/")
+	if err != nil || len(page) != 0 || pagination != (Pagination{}) {
+		t.Errorf("Empty first page %v %+v %v", page, pagination, err)
+	}
+}
+
+func TestArticlesPages(t *testing.T) {
+	setupTestContent(t)
+	siteGlobal.ArticlesPerPage = 1
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	writeTestArticle(t, "second", `{"Title": "Second", "DateCreated": "2020-01-02 10:00"}`, "Body")
+
+	tests := []struct {
+		path    string
+		code    int
+		article string
+	}{
+		{"/", 200, "/article/second"},
+		{"/articles/page/2", 200, "/article/first"},
+		{"/articles/page/3", 404, ""},
+		{"/articles/page/99999999999999999999", 404, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		articlesHandler(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("Status %d for %s", w.Code, test.path)
+		}
+		if len(test.article) > 0 && !strings.Contains(w.Body.String(), test.article) {
+			t.Errorf("Page %s does not link to %s", test.path, test.article)
+		}
+	}
+}
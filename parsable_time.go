@@ -12,6 +12,14 @@ import (
 
 const timeFormat = "2006-01-02 15:04"
 
+// Formats accepted in addition to timeFormat, used by front matter of
+// other static site generators
+var alternativeTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
 type ParsableTime struct {
 	time.Time
 }
@@ -24,6 +32,15 @@ func (new_time *ParsableTime) UnmarshalJSON(data []byte) error {
 	}
 
 	parsed, err := time.Parse(timeFormat, strs[1])
+	for _, format := range alternativeTimeFormats {
+		if nil == err {
+			break
+		}
+		// Report error of the main format if none of the formats match
+		if alternative, alternative_err := time.Parse(format, strs[1]); nil == alternative_err {
+			parsed, err = alternative, nil
+		}
+	}
 	if nil != err {
 		log.Print("ParsableTime failed to parse string: " + strs[1])
 		return err
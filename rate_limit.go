@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCommentsPerMinutePerIp      = 2.0
+	defaultCommentBurstPerIp           = 3
+	defaultCommentsPerMinutePerArticle = 10.0
+	defaultCommentBurstPerArticle      = 10
+
+	// How often idle buckets are removed
+	rateLimitPruneInterval = time.Minute
+)
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Token bucket rate limiter. Each key has a bucket of 'Burst' tokens which
+// refills at 'Rate' tokens per second, and each request takes one token.
+type RateLimiter struct {
+	Rate  float64
+	Burst int
+
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+var (
+	commentIpLimiter      *RateLimiter
+	commentArticleLimiter *RateLimiter
+)
+
+func NewRateLimiter(per_minute float64, burst int) *RateLimiter {
+	limiter := new(RateLimiter)
+	limiter.Rate = per_minute / 60
+	limiter.Burst = burst
+	limiter.buckets = make(map[string]*tokenBucket)
+	limiter.pruned = time.Now()
+	return limiter
+}
+
+// Time after which an unused bucket is full again, and can be forgotten
+func (limiter *RateLimiter) refillTime() time.Duration {
+	return time.Duration(float64(limiter.Burst) / limiter.Rate * float64(time.Second))
+}
+
+// Removes buckets which have refilled. Caller must hold the mutex.
+func (limiter *RateLimiter) prune(now time.Time) {
+	if now.Sub(limiter.pruned) < rateLimitPruneInterval {
+		return
+	}
+	limiter.pruned = now
+	for key, bucket := range limiter.buckets {
+		if now.Sub(bucket.updated) > limiter.refillTime() {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// Takes a token of the key. Returns false and the time until the next
+// token if there are none left.
+func (limiter *RateLimiter) Allow(key string) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	limiter.prune(now)
+
+	bucket, found := limiter.buckets[key]
+	if !found {
+		bucket = &tokenBucket{float64(limiter.Burst), now}
+		limiter.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.updated).Seconds()
+	bucket.tokens = math.Min(float64(limiter.Burst), bucket.tokens+elapsed*limiter.Rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		wait := (1 - bucket.tokens) / limiter.Rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	bucket.tokens -= 1
+	return true, 0
+}
+
+// Gives back a token taken by Allow, used when the request is denied for
+// another reason
+func (limiter *RateLimiter) Refund(key string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if bucket, found := limiter.buckets[key]; found {
+		bucket.tokens = math.Min(float64(limiter.Burst), bucket.tokens+1)
+	}
+}
+
+// Creates the comment rate limiters from the site config
+func initRateLimits() {
+	per_ip := siteGlobal.CommentsPerMinutePerIp
+	if per_ip <= 0 {
+		per_ip = defaultCommentsPerMinutePerIp
+	}
+	burst_ip := siteGlobal.CommentBurstPerIp
+	if burst_ip <= 0 {
+		burst_ip = defaultCommentBurstPerIp
+	}
+	per_article := siteGlobal.CommentsPerMinutePerArticle
+	if per_article <= 0 {
+		per_article = defaultCommentsPerMinutePerArticle
+	}
+	burst_article := siteGlobal.CommentBurstPerArticle
+	if burst_article <= 0 {
+		burst_article = defaultCommentBurstPerArticle
+	}
+
+	commentIpLimiter = NewRateLimiter(per_ip, burst_ip)
+	commentArticleLimiter = NewRateLimiter(per_article, burst_article)
+}
+
+// Returns false and the time to wait if the client or the article has
+// received too many comments
+func allowComment(r *http.Request, article_id string) (bool, time.Duration) {
+	ip := clientIp(r)
+	if allowed, wait := commentIpLimiter.Allow(ip); !allowed {
+		return false, wait
+	}
+	allowed, wait := commentArticleLimiter.Allow(article_id)
+	if !allowed {
+		// Client is not charged for comments the article did not accept
+		commentIpLimiter.Refund(ip)
+	}
+	return allowed, wait
+}
+
+// Returns true if the client is a browser, other clients get plain errors
+func acceptsHtml(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	limiter := NewRateLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.Allow("a"); !allowed {
+			t.Fatalf("Request %d of the burst was denied", i+1)
+		}
+	}
+	allowed, wait := limiter.Allow("a")
+	if allowed {
+		t.Fatal("Request after the burst was allowed")
+	}
+	if wait < 29*time.Second || wait > 30*time.Second {
+		t.Errorf("Wait is %v, one token takes 30 seconds", wait)
+	}
+	if allowed, _ = limiter.Allow("b"); !allowed {
+		t.Error("Other key was limited")
+	}
+
+	// Half a minute later one token has been added
+	limiter.buckets["a"].updated = limiter.buckets["a"].updated.Add(-30 * time.Second)
+	if allowed, _ = limiter.Allow("a"); !allowed {
+		t.Error("Refilled token was not allowed")
+	}
+	if allowed, _ = limiter.Allow("a"); allowed {
+		t.Error("More than the refilled tokens were allowed")
+	}
+}
+
+func TestRateLimiterPrunesFullBuckets(t *testing.T) {
+	limiter := NewRateLimiter(60, 2)
+	limiter.Allow("old")
+	limiter.Allow("new")
+
+	limiter.buckets["old"].updated = time.Now().Add(-time.Minute)
+	limiter.pruned = time.Now().Add(-2 * rateLimitPruneInterval)
+	limiter.Allow("new")
+
+	if _, found := limiter.buckets["old"]; found {
+		t.Error("Refilled bucket was not removed")
+	}
+	if _, found := limiter.buckets["new"]; !found {
+		t.Error("Used bucket was removed")
+	}
+}
+
+func TestCommentDeniedByArticleLimitKeepsIpToken(t *testing.T) {
+	old_ip, old_article := commentIpLimiter, commentArticleLimiter
+	defer func() { commentIpLimiter, commentArticleLimiter = old_ip, old_article }()
+	commentIpLimiter = NewRateLimiter(1, 3)
+	commentArticleLimiter = NewRateLimiter(1, 1)
+
+	r := httptest.NewRequest("POST", "/article/first", nil)
+	expected := []struct {
+		article_id string
+		allowed    bool
+	}{
+		{"first", true},
+		// Denied by the article, the client keeps its token
+		{"first", false},
+		{"second", true},
+		{"third", true},
+		{"fourth", false},
+	}
+	for idx, test := range expected {
+		if allowed, _ := allowComment(r, test.article_id); allowed != test.allowed {
+			t.Errorf("Comment %d to %s allowed: %v", idx+1, test.article_id, allowed)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultNumRelatedArticles = 5
+	// Weights of tag overlap and text similarity, both are between 0 and 1
+	relatedTagWeight  = 0.5
+	relatedTextWeight = 0.5
+)
+
+// Data needed for finding related articles among the listed articles
+type RelatedIndex struct {
+	articles []*Article
+	// Normalized TF-IDF vector of each article
+	vectors []map[string]float64
+	termIdf map[string]float64
+	tagIdf  map[string]float64
+
+	// Already computed related articles by article id
+	mutex   sync.Mutex
+	related map[string][]*Article
+}
+
+type relatedScore struct {
+	article *Article
+	score   float64
+}
+
+var relatedIndex = newListingIndex(func(articles []*Article) interface{} {
+	return NewRelatedIndex(articles)
+})
+
+func numRelatedArticles() int {
+	if siteGlobal.NumRelatedArticles <= 0 {
+		return defaultNumRelatedArticles
+	}
+	return siteGlobal.NumRelatedArticles
+}
+
+func inverseFrequency(num_documents int, document_frequency int) float64 {
+	return math.Log(float64(num_documents+1) / float64(document_frequency+1))
+}
+
+func NewRelatedIndex(articles []*Article) *RelatedIndex {
+	index := new(RelatedIndex)
+	index.articles = articles
+	index.termIdf = make(map[string]float64)
+	index.tagIdf = make(map[string]float64)
+	index.related = make(map[string][]*Article)
+
+	term_counts := make([]map[string]int, len(articles))
+	term_frequency := make(map[string]int)
+	tag_frequency := make(map[string]int)
+	for idx, article := range articles {
+		term_counts[idx] = make(map[string]int)
+		for _, term := range tokenize(article.PlainText) {
+			term_counts[idx][term]++
+		}
+		for term := range term_counts[idx] {
+			term_frequency[term]++
+		}
+		for _, tag := range article.Tags {
+			tag_frequency[normalizeTag(tag)]++
+		}
+	}
+
+	for term, frequency := range term_frequency {
+		index.termIdf[term] = inverseFrequency(len(articles), frequency)
+	}
+	for tag, frequency := range tag_frequency {
+		index.tagIdf[tag] = inverseFrequency(len(articles), frequency)
+	}
+
+	index.vectors = make([]map[string]float64, len(articles))
+	for idx := range articles {
+		index.vectors[idx] = index.vector(term_counts[idx])
+	}
+
+	return index
+}
+
+// Returns normalized TF-IDF vector of the term counts
+func (index *RelatedIndex) vector(term_counts map[string]int) map[string]float64 {
+	vector := make(map[string]float64)
+	length := 0.0
+	for term, count := range term_counts {
+		value := float64(count) * index.termIdf[term]
+		if value > 0 {
+			vector[term] = value
+			length += value * value
+		}
+	}
+
+	length = math.Sqrt(length)
+	for term := range vector {
+		vector[term] /= length
+	}
+
+	return vector
+}
+
+func cosineSimilarity(a map[string]float64, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	similarity := 0.0
+	for term, value := range a {
+		similarity += value * b[term]
+	}
+	return similarity
+}
+
+// Returns share of the rarity weighted tags of the article which are
+// also in the other article
+func (index *RelatedIndex) tagOverlap(article *Article, other *Article) float64 {
+	total := 0.0
+	shared := 0.0
+	for _, tag := range article.Tags {
+		// Tags which are not in any listed article are the rarest
+		weight, found := index.tagIdf[normalizeTag(tag)]
+		if !found {
+			weight = inverseFrequency(len(index.articles), 0)
+		}
+		total += weight
+		if hasTag(other.Tags, tag) {
+			shared += weight
+		}
+	}
+	if total <= 0 {
+		return 0
+	}
+	return shared / total
+}
+
+func (index *RelatedIndex) compute(article *Article) []*Article {
+	term_counts := make(map[string]int)
+	for _, term := range tokenize(article.PlainText) {
+		term_counts[term]++
+	}
+	vector := index.vector(term_counts)
+
+	scores := []relatedScore{}
+	for idx, other := range index.articles {
+		if other.Id == article.Id {
+			continue
+		}
+		score := relatedTagWeight*index.tagOverlap(article, other) +
+			relatedTextWeight*cosineSimilarity(vector, index.vectors[idx])
+		if score > 0 {
+			scores = append(scores, relatedScore{other, score})
+		}
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].score > scores[j].score
+	})
+
+	related := []*Article{}
+	for idx := 0; idx < len(scores) && idx < numRelatedArticles(); idx++ {
+		related = append(related, scores[idx].article)
+	}
+
+	return related
+}
+
+// Returns related listed articles, most related first
+func (index *RelatedIndex) Related(article *Article) []*Article {
+	index.mutex.Lock()
+	related, found := index.related[article.Id]
+	index.mutex.Unlock()
+	if found {
+		return related
+	}
+
+	related = index.compute(article)
+
+	index.mutex.Lock()
+	index.related[article.Id] = related
+	index.mutex.Unlock()
+
+	return related
+}
+
+func getRelatedIndex() *RelatedIndex {
+	return relatedIndex.Get().(*RelatedIndex)
+}
+
+func fillRelatedArticles(article *Article) {
+	article.RelatedArticles = getRelatedIndex().Related(article)
+}
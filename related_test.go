@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func relatedIds(t *testing.T, id string) []string {
+	t.Helper()
+	article, err := articleStore.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, related := range NewRelatedIndex(GetAllArticles()).Related(article) {
+		ids = append(ids, related.Id)
+	}
+	return ids
+}
+
+func TestRelatedArticlesByTags(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "base", `{"Title": "Base", "DateCreated": "2020-01-01 10:00",
+		"Tags": ["opencv", "Stereo"]}`, "alpha")
+	writeTestArticle(t, "rare", `{"Title": "Rare", "DateCreated": "2020-01-02 10:00", "Tags": ["stereo"]}`, "beta")
+	writeTestArticle(t, "common", `{"Title": "Common", "DateCreated": "2020-01-03 10:00", "Tags": ["opencv"]}`, "gamma")
+	writeTestArticle(t, "common2", `{"Title": "Common", "DateCreated": "2020-01-04 10:00", "Tags": ["opencv"]}`, "delta")
+	writeTestArticle(t, "common3", `{"Title": "Common", "DateCreated": "2020-01-05 10:00", "Tags": ["opencv"]}`, "epsilon")
+	writeTestArticle(t, "unrelated", `{"Title": "Unrelated", "DateCreated": "2020-01-06 10:00"}`, "zeta")
+	writeTestArticle(t, "draft", `{"Title": "Draft", "DateCreated": "2020-01-07 10:00", "Status": "draft",
+		"Tags": ["opencv", "stereo"]}`, "alpha")
+
+	// Rarer shared tag is the stronger relation
+	ids := relatedIds(t, "base")
+	if len(ids) != 4 || ids[0] != "rare" {
+		t.Errorf("Related articles %v", ids)
+	}
+	for _, id := range ids {
+		if id == "base" || id == "unrelated" || id == "draft" {
+			t.Errorf("Related articles %v contain %s", ids, id)
+		}
+	}
+
+	siteGlobal.NumRelatedArticles = 2
+	if ids = relatedIds(t, "base"); len(ids) != 2 || ids[0] != "rare" {
+		t.Errorf("Limited related articles %v", ids)
+	}
+}
+
+func TestRelatedArticlesByText(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "base", `{"Title": "Base", "DateCreated": "2020-01-01 10:00"}`,
+		"Canny edge detection finds edges.")
+	writeTestArticle(t, "similar", `{"Title": "Similar", "DateCreated": "2020-01-02 10:00"}`,
+		"Edge detection tutorial, the Canny way.")
+	writeTestArticle(t, "other", `{"Title": "Other", "DateCreated": "2020-01-03 10:00"}`,
+		"Cooking recipes for the holidays.")
+
+	if ids := relatedIds(t, "base"); len(ids) != 1 || ids[0] != "similar" {
+		t.Errorf("Related articles %v", ids)
+	}
+}
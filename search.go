@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Indexed fields of an article
+const (
+	searchFieldTitle = iota
+	searchFieldTags
+	searchFieldLongTitle
+	searchFieldDescription
+	searchFieldBody
+	numSearchFields
+)
+
+// Title and tag matches are worth more than body matches
+var searchFieldWeights = [numSearchFields]float64{10, 8, 5, 3, 1}
+
+// Positions of a term in one field of one article
+type searchPosting struct {
+	article   int
+	field     int
+	positions []int
+}
+
+// Inverted index from terms to the articles containing them
+type SearchIndex struct {
+	articles []*Article
+	terms    map[string][]searchPosting
+}
+
+type SearchResult struct {
+	Article *Article
+	Score   float64
+}
+
+type searchQuery struct {
+	// All terms and phrases must be found from the article
+	terms   []string
+	phrases [][]string
+	// Article must have all of the tags
+	tags []string
+}
+
+type SearchData struct {
+	SiteGlobal
+	PageData
+	Articles   Articles
+	Query      string
+	NumResults int
+}
+
+var (
+	// Words, quoted phrases and tag filters such as 'tag:opencv'
+	searchQueryPart = regexp.MustCompile("(tag:)?(\"[^\"]*\"?|[^\\s]+)")
+
+	markdownLinkTarget = regexp.MustCompile("\\]\\([^)]*\\)")
+	htmlTag            = regexp.MustCompile("<[^>]*>")
+
+	searchIndex = newListingIndex(func(articles []*Article) interface{} {
+		return NewSearchIndex(articles)
+	})
+)
+
+// Removes LaTeX blocks, link targets and HTML tags. Rest of the markdown
+// syntax is removed by the tokenizer.
+func markdownToPlainText(data []byte) string {
+	text := latexBlock.ReplaceAll(data, []byte(" "))
+	text = markdownLinkTarget.ReplaceAll(text, []byte("]"))
+	text = htmlTag.ReplaceAll(text, []byte(" "))
+	return string(text)
+}
+
+// Splits text to lower case words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+func NewSearchIndex(articles []*Article) *SearchIndex {
+	index := new(SearchIndex)
+	index.articles = articles
+	index.terms = make(map[string][]searchPosting)
+
+	for article_idx, article := range articles {
+		fields := [numSearchFields]string{}
+		fields[searchFieldTitle] = article.Title
+		fields[searchFieldTags] = strings.Join(article.Tags, " ")
+		fields[searchFieldLongTitle] = article.LongTitle
+		fields[searchFieldDescription] = article.Description
+		fields[searchFieldBody] = article.PlainText
+
+		for field, text := range fields {
+			positions := make(map[string][]int)
+			for position, term := range tokenize(text) {
+				positions[term] = append(positions[term], position)
+			}
+			for term, term_positions := range positions {
+				posting := searchPosting{article_idx, field, term_positions}
+				index.terms[term] = append(index.terms[term], posting)
+			}
+		}
+	}
+
+	return index
+}
+
+func getSearchIndex() *SearchIndex {
+	return searchIndex.Get().(*SearchIndex)
+}
+
+func parseSearchQuery(query_string string) searchQuery {
+	query := searchQuery{}
+	for _, m := range searchQueryPart.FindAllStringSubmatch(query_string, -1) {
+		is_tag := len(m[1]) > 0
+		value := strings.Trim(m[2], "\"")
+
+		if is_tag {
+			if len(value) > 0 {
+				query.tags = append(query.tags, value)
+			}
+			continue
+		}
+
+		terms := tokenize(value)
+		if len(terms) == 1 {
+			query.terms = append(query.terms, terms[0])
+		} else if len(terms) > 1 {
+			// Quoted text and words such as "open-source" are phrases
+			query.phrases = append(query.phrases, terms)
+		}
+	}
+	return query
+}
+
+// Inverse document frequency of term with the postings
+func (index *SearchIndex) idf(postings []searchPosting) float64 {
+	articles := make(map[int]bool)
+	for _, posting := range postings {
+		articles[posting.article] = true
+	}
+	return math.Log(1 + float64(len(index.articles))/float64(1+len(articles)))
+}
+
+// Returns score per article containing the term
+func (index *SearchIndex) matchTerm(term string) map[int]float64 {
+	matches := make(map[int]float64)
+	postings := index.terms[term]
+	idf := index.idf(postings)
+	for _, posting := range postings {
+		matches[posting.article] += searchFieldWeights[posting.field] *
+			float64(len(posting.positions)) * idf
+	}
+	return matches
+}
+
+func containsPosition(positions []int, position int) bool {
+	idx := sort.SearchInts(positions, position)
+	return idx < len(positions) && positions[idx] == position
+}
+
+// Returns score per article containing the terms in consecutive positions
+// of the same field
+func (index *SearchIndex) matchPhrase(phrase []string) map[int]float64 {
+	matches := make(map[int]float64)
+
+	// Positions of each phrase term indexed by article and field
+	positions := make([]map[[2]int][]int, len(phrase))
+	for idx, term := range phrase {
+		positions[idx] = make(map[[2]int][]int)
+		for _, posting := range index.terms[term] {
+			positions[idx][[2]int{posting.article, posting.field}] = posting.positions
+		}
+	}
+
+	idf := index.idf(index.terms[phrase[0]])
+	for _, posting := range index.terms[phrase[0]] {
+		key := [2]int{posting.article, posting.field}
+		for _, begin := range posting.positions {
+			found := true
+			for idx := 1; idx < len(phrase) && found; idx++ {
+				found = containsPosition(positions[idx][key], begin+idx)
+			}
+			if found {
+				// Phrase is worth more than the same words separately
+				matches[posting.article] += searchFieldWeights[posting.field] *
+					float64(len(phrase)) * idf
+			}
+		}
+	}
+
+	return matches
+}
+
+// Keeps only articles found from both. Nil scores means no restrictions yet.
+func intersectScores(scores map[int]float64, matches map[int]float64) map[int]float64 {
+	if scores == nil {
+		return matches
+	}
+	for article, score := range scores {
+		match, found := matches[article]
+		if !found {
+			delete(scores, article)
+			continue
+		}
+		scores[article] = score + match
+	}
+	return scores
+}
+
+func hasAllTags(article *Article, tags []string) bool {
+	for _, tag := range tags {
+		if !hasTag(article.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns matching articles, best match first
+func (index *SearchIndex) Search(query_string string) []SearchResult {
+	query := parseSearchQuery(query_string)
+
+	var scores map[int]float64
+	for _, term := range query.terms {
+		scores = intersectScores(scores, index.matchTerm(term))
+	}
+	for _, phrase := range query.phrases {
+		scores = intersectScores(scores, index.matchPhrase(phrase))
+	}
+
+	if scores == nil {
+		if len(query.tags) == 0 {
+			// Empty query
+			return []SearchResult{}
+		}
+		// Only tag filters, all articles are candidates
+		scores = make(map[int]float64)
+		for idx := range index.articles {
+			scores[idx] = 0
+		}
+	}
+
+	results := []SearchResult{}
+	for article_idx, score := range scores {
+		article := index.articles[article_idx]
+		if hasAllTags(article, query.tags) {
+			results = append(results, SearchResult{article, score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Article.DateCreated.After(results[j].Article.DateCreated.Time)
+	})
+
+	return results
+}
+
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.FormValue("q")
+	results := getSearchIndex().Search(query)
+
+	articles := make([]*Article, len(results))
+	for idx, result := range results {
+		articles[idx] = result.Article
+	}
+
+	data := SearchData{}
+	data.SiteGlobal = siteGlobal
+	data.PageData = newPageData()
+	data.Title = "Search"
+	data.Query = query
+	data.NumResults = len(results)
+	data.Articles = SplitRawArticlesIntoColumns(articles)
+
+	renderTemplate(w, "search", data)
+}
+
+type searchResultJson struct {
+	Id          string
+	Link        string
+	Title       string
+	LongTitle   string
+	Description string
+	Tags        []string
+	Score       float64
+}
+
+func searchJsonHandler(w http.ResponseWriter, r *http.Request) {
+	results := getSearchIndex().Search(r.FormValue("q"))
+
+	results_json := make([]searchResultJson, len(results))
+	for idx, result := range results {
+		article := result.Article
+		results_json[idx] = searchResultJson{
+			Id:          article.Id,
+			Link:        article.Link,
+			Title:       article.Title,
+			LongTitle:   article.LongTitle,
+			Description: article.Description,
+			Tags:        article.Tags,
+			Score:       result.Score,
+		}
+	}
+
+	bytes, err := json.Marshal(results_json)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
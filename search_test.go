@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	query := parseSearchQuery(`Edge tag:opencv "image processing" open-source tag:"Computer Vision"`)
+	if !reflect.DeepEqual(query.terms, []string{"edge"}) {
+		t.Errorf("Terms %v", query.terms)
+	}
+	if !reflect.DeepEqual(query.phrases, [][]string{{"image", "processing"}, {"open", "source"}}) {
+		t.Errorf("Phrases %v", query.phrases)
+	}
+	if !reflect.DeepEqual(query.tags, []string{"opencv", "Computer Vision"}) {
+		t.Errorf("Tags %v", query.tags)
+	}
+}
+
+func searchIds(results []SearchResult) []string {
+	ids := []string{}
+	for _, result := range results {
+		ids = append(ids, result.Article.Id)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "titled", `{"Title": "Edge detection", "DateCreated": "2020-01-01 10:00",
+		"Tags": ["opencv"]}`, "Finding lines.")
+	writeTestArticle(t, "body", `{"Title": "Filters", "DateCreated": "2020-01-02 10:00"}`,
+		"Blur before edge detection. Processing the image.")
+	writeTestArticle(t, "phrase", `{"Title": "Pipelines", "DateCreated": "2020-01-03 10:00"}`,
+		"Image processing of an edge.")
+	writeTestArticle(t, "draft", `{"Title": "Edge draft", "DateCreated": "2020-01-04 10:00",
+		"Status": "draft"}`, "Edge")
+
+	index := NewSearchIndex(GetAllArticles())
+	tests := []struct {
+		query string
+		ids   []string
+	}{
+		// Title matches rank above body matches, drafts are not searched
+		{"edge", []string{"titled", "phrase", "body"}},
+		{"edge detection", []string{"titled", "body"}},
+		{`"image processing"`, []string{"phrase"}},
+		{"edge tag:opencv", []string{"titled"}},
+		{"tag:opencv", []string{"titled"}},
+		{"missing", []string{}},
+		{"", []string{}},
+	}
+	for _, test := range tests {
+		if ids := searchIds(index.Search(test.query)); !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("Query '%s' found %v, expected %v", test.query, ids, test.ids)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	searchJsonHandler(w, httptest.NewRequest("GET", "/search.json?q=pipelines", nil))
+	results := []searchResultJson{}
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Id != "phrase" || results[0].Score <= 0 {
+		t.Errorf("JSON results %+v", results)
+	}
+}
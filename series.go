@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+type ArticleSeries struct {
+	// Articles with the same series id belong to the same series
+	Id string
+	// Name shown to the user, id is used if empty
+	Name string
+	// Position of the article in the series, first part is 1
+	Part int
+}
+
+type SeriesData struct {
+	SiteGlobal
+	PageData
+	Series   ArticleSeries
+	Articles Articles
+}
+
+var validSeries = regexp.MustCompile("^/(series)/([a-zA-Z0-9_]+)$")
+
+func (series ArticleSeries) DisplayName() string {
+	if len(series.Name) > 0 {
+		return series.Name
+	}
+	return series.Id
+}
+
+// Helper type for sorting
+type BySeriesPart []*Article
+
+// Helper funcition for sorting
+func (this BySeriesPart) Len() int {
+	return len(this)
+}
+
+// Helper funcition for sorting
+func (this BySeriesPart) Less(i, j int) bool {
+	if this[i].Series.Part != this[j].Series.Part {
+		return this[i].Series.Part < this[j].Series.Part
+	}
+	return this[i].DateCreated.Before(this[j].DateCreated.Time)
+}
+
+// Helper funcition for sorting
+func (this BySeriesPart) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+}
+
+// Returns listed articles of the series in order
+func GetArticlesBySeries(id string) []*Article {
+	articles := []*Article{}
+	for _, article := range GetAllArticles() {
+		if article.Series.Id == id {
+			articles = append(articles, article)
+		}
+	}
+
+	sort.Sort(BySeriesPart(articles))
+
+	return articles
+}
+
+// Returns series information with the name taken from any of the parts
+func getSeriesInfo(id string, articles []*Article) ArticleSeries {
+	series := ArticleSeries{Id: id}
+	for _, article := range articles {
+		if len(article.Series.Name) > 0 {
+			series.Name = article.Series.Name
+			break
+		}
+	}
+	return series
+}
+
+// Fills table of contents and links to the previous and next parts.
+// This is done when the article is shown, not when the article is parsed,
+// as other parts of the series might change independently.
+func fillSeriesNavigation(article *Article) {
+	if len(article.Series.Id) == 0 {
+		return
+	}
+
+	parts := GetArticlesBySeries(article.Series.Id)
+	article.SeriesParts = parts
+	if len(article.Series.Name) == 0 {
+		article.Series.Name = getSeriesInfo(article.Series.Id, parts).Name
+	}
+
+	for idx, part := range parts {
+		if part.Id != article.Id {
+			continue
+		}
+		if idx > 0 {
+			article.SeriesPrev = parts[idx-1]
+			article.Pagination.Prev = "/article/" + article.SeriesPrev.Id
+		}
+		if idx+1 < len(parts) {
+			article.SeriesNext = parts[idx+1]
+			article.Pagination.Next = "/article/" + article.SeriesNext.Id
+		}
+	}
+}
+
+// Title used in feeds, contains the series name and part
+func (article *Article) TitleWithSeries() string {
+	if len(article.Series.Id) == 0 {
+		return article.Title
+	}
+	return article.Series.DisplayName() + ", part " +
+		strconv.Itoa(article.Series.Part) + ": " + article.Title
+}
+
+func getSeriesId(r *http.Request) (string, error) {
+	m := validSeries.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		return "", errors.New("Invalid series from request: " + r.URL.Path)
+	}
+
+	return m[2], nil // The id is the second subexpression.
+}
+
+func seriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getSeriesId(r)
+	if err != nil {
+		http.NotFound(w, r)
+		log.Print("Could not parse series from request:" + err.Error())
+		return
+	}
+
+	articles := GetArticlesBySeries(id)
+	if len(articles) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := SeriesData{}
+	data.SiteGlobal = siteGlobal
+	data.PageData = newPageData()
+	data.Series = getSeriesInfo(id, articles)
+	data.Title = data.Series.DisplayName()
+	data.Articles = SplitRawArticlesIntoColumns(articles)
+
+	renderTemplate(w, "series", data)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func writeTestSeries(t *testing.T) {
+	t.Helper()
+	writeTestArticle(t, "second", `{"Title": "Second", "DateCreated": "2020-01-01 10:00",
+		"Series": {"Id": "cv", "Part": 2}}`, "Body")
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-02 10:00",
+		"Series": {"Id": "cv", "Name": "Computer vision", "Part": 1}}`, "Body")
+	writeTestArticle(t, "third", `{"Title": "Third", "DateCreated": "2020-01-03 10:00",
+		"Series": {"Id": "cv", "Part": 3}}`, "Body")
+	writeTestArticle(t, "draft", `{"Title": "Draft", "DateCreated": "2020-01-04 10:00", "Status": "draft",
+		"Series": {"Id": "cv", "Part": 4}}`, "Body")
+	writeTestArticle(t, "other", `{"Title": "Other", "DateCreated": "2020-01-05 10:00"}`, "Body")
+}
+
+func TestGetArticlesBySeries(t *testing.T) {
+	setupTestContent(t)
+	writeTestSeries(t)
+
+	parts := GetArticlesBySeries("cv")
+	order := ""
+	for _, part := range parts {
+		order += part.Id + " "
+	}
+	if order != "first second third " {
+		t.Errorf("Series parts in order '%s'", order)
+	}
+	if len(GetArticlesBySeries("missing")) != 0 {
+		t.Error("Unknown series has parts")
+	}
+}
+
+func TestSeriesNavigation(t *testing.T) {
+	setupTestContent(t)
+	writeTestSeries(t)
+
+	cached, _ := articleStore.Get("second")
+	article := new(Article)
+	*article = *cached
+	article.PageData = newPageData()
+	fillSeriesNavigation(article)
+
+	if len(article.SeriesParts) != 3 || article.SeriesPrev.Id != "first" || article.SeriesNext.Id != "third" {
+		t.Errorf("Navigation of the second part %v, %v, %v", article.SeriesParts, article.SeriesPrev, article.SeriesNext)
+	}
+	if article.Pagination.Prev != "/article/first" || article.Pagination.Next != "/article/third" {
+		t.Errorf("Pagination %+v", article.Pagination)
+	}
+	// Name is taken from the first part
+	if title := article.TitleWithSeries(); title != "Computer vision, part 2: Second" {
+		t.Errorf("Title with series '%s'", title)
+	}
+	if cached.SeriesParts != nil || len(cached.Series.Name) > 0 {
+		t.Error("Navigation was filled to the cached article")
+	}
+
+	first, _ := articleStore.Get("first")
+	article = new(Article)
+	*article = *first
+	fillSeriesNavigation(article)
+	if article.SeriesPrev != nil || article.SeriesNext.Id != "second" {
+		t.Error("First part links to a previous part")
+	}
+}
+
+func TestSeriesHandler(t *testing.T) {
+	setupTestContent(t)
+	writeTestSeries(t)
+
+	for path, code := range map[string]int{"/series/cv": 200, "/series/missing": 404, "/series/a-b": 404} {
+		w := httptest.NewRecorder()
+		seriesHandler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Errorf("Status %d for %s", w.Code, path)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	sitemapNamespace  = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	sitemapDateFormat = "2006-01-02"
+	// Maximum allowed by the sitemap protocol
+	defaultSitemapMaxUrls = 50000
+	defaultRobotsTxt      = "User-agent: *\nDisallow: /login\nDisallow: /logout\nDisallow: /admin/\n"
+)
+
+type SitemapUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type SitemapUrlSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Urls    []SitemapUrl `xml:"url"`
+}
+
+type SitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Sitemaps []SitemapUrl `xml:"sitemap"`
+}
+
+var validSitemapPart = regexp.MustCompile("^/(sitemap)/([0-9]+)\\.xml$")
+
+func sitemapMaxUrls() int {
+	if siteGlobal.SitemapMaxUrls <= 0 {
+		return defaultSitemapMaxUrls
+	}
+	return siteGlobal.SitemapMaxUrls
+}
+
+func sitemapDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(sitemapDateFormat)
+}
+
+// Returns modification time of the article, creation time if the article
+// has never been modified
+func articleLastModified(article *Article) time.Time {
+	if article.DateModified.After(article.DateCreated.Time) {
+		return article.DateModified.Time
+	}
+	return article.DateCreated.Time
+}
+
+// Returns all URLs of the site, drafts and unlisted articles are excluded
+func getSitemapUrls() []SitemapUrl {
+	articles := GetAllArticles()
+
+	newest := time.Time{}
+	for _, article := range articles {
+		if modified := articleLastModified(article); modified.After(newest) {
+			newest = modified
+		}
+	}
+
+	urls := []SitemapUrl{}
+	urls = append(urls, SitemapUrl{websiteAddress() + "/", sitemapDate(newest)})
+	urls = append(urls, SitemapUrl{websiteAddress() + "/about/", ""})
+
+	for _, article := range articles {
+		urls = append(urls, SitemapUrl{article.Link, sitemapDate(articleLastModified(article))})
+	}
+
+	for _, tag := range getAllTags(articles) {
+		if !validTag.MatchString("/tag/" + tag) {
+			continue
+		}
+		tagged, _ := GetArticlesByTag(tag)
+		tag_newest := time.Time{}
+		for _, article := range tagged {
+			if modified := articleLastModified(article); modified.After(tag_newest) {
+				tag_newest = modified
+			}
+		}
+		loc := websiteAddress() + "/tag/" + url.PathEscape(tag)
+		urls = append(urls, SitemapUrl{loc, sitemapDate(tag_newest)})
+	}
+
+	series := make(map[string]bool)
+	for _, article := range articles {
+		id := article.Series.Id
+		if len(id) > 0 && !series[id] {
+			series[id] = true
+			urls = append(urls, SitemapUrl{websiteAddress() + "/series/" + id, ""})
+		}
+	}
+
+	return urls
+}
+
+func writeXml(w http.ResponseWriter, data interface{}) {
+	bytes, err := xml.MarshalIndent(data, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(bytes)
+}
+
+// Returns sitemap, or sitemap index if there are too many URLs for
+// a single sitemap
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	urls := getSitemapUrls()
+	max_urls := sitemapMaxUrls()
+
+	if len(urls) <= max_urls {
+		writeXml(w, SitemapUrlSet{Xmlns: sitemapNamespace, Urls: urls})
+		return
+	}
+
+	index := SitemapIndex{Xmlns: sitemapNamespace}
+	for part := 1; (part-1)*max_urls < len(urls); part++ {
+		loc := websiteAddress() + "/sitemap/" + strconv.Itoa(part) + ".xml"
+		index.Sitemaps = append(index.Sitemaps, SitemapUrl{Loc: loc})
+	}
+	writeXml(w, index)
+}
+
+func getSitemapPart(r *http.Request) (int, error) {
+	m := validSitemapPart.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		return 0, errors.New("Invalid sitemap from request: " + r.URL.Path)
+	}
+
+	return strconv.Atoi(m[2]) // The part is the second subexpression.
+}
+
+// Returns one part of a split sitemap
+func sitemapPartHandler(w http.ResponseWriter, r *http.Request) {
+	part, err := getSitemapPart(r)
+	if err != nil {
+		http.NotFound(w, r)
+		log.Print("Could not parse sitemap part from request:" + err.Error())
+		return
+	}
+
+	urls := getSitemapUrls()
+	max_urls := sitemapMaxUrls()
+	// Checked before multiplying, large part numbers would overflow
+	num_parts := (len(urls) + max_urls - 1) / max_urls
+	if part < 1 || part > num_parts || len(urls) <= max_urls {
+		http.NotFound(w, r)
+		return
+	}
+	begin := (part - 1) * max_urls
+	end := begin + max_urls
+	if end > len(urls) {
+		end = len(urls)
+	}
+
+	writeXml(w, SitemapUrlSet{Xmlns: sitemapNamespace, Urls: urls[begin:end]})
+}
+
+func robotsHandler(w http.ResponseWriter, r *http.Request) {
+	robots := siteGlobal.RobotsTxt
+	if len(robots) == 0 {
+		robots = defaultRobotsTxt
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(robots + "\nSitemap: " + websiteAddress() + "/sitemap.xml\n"))
+}
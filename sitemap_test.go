@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSitemapIsSplitIntoParts(t *testing.T) {
+	setupTestContent(t)
+	siteGlobal.Address = "https://example.com"
+	siteGlobal.SitemapMaxUrls = 2
+	for _, id := range []string{"first", "second", "third"} {
+		writeTestArticle(t, id, `{"Title": "Article", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	}
+
+	w := httptest.NewRecorder()
+	sitemapHandler(w, httptest.NewRequest("GET", "/sitemap.xml", nil))
+	index := SitemapIndex{}
+	if err := xml.Unmarshal(w.Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	// Front page, about page and the articles
+	if len(index.Sitemaps) != 3 || index.Sitemaps[2].Loc != "https://example.com/sitemap/3.xml" {
+		t.Fatalf("Sitemap index %+v", index.Sitemaps)
+	}
+
+	num_urls := 0
+	for part, expected := range []int{2, 2, 1} {
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest("GET", index.Sitemaps[part].Loc, nil)
+		sitemapPartHandler(w, r)
+		urls := SitemapUrlSet{}
+		if err := xml.Unmarshal(w.Body.Bytes(), &urls); err != nil {
+			t.Fatal(err)
+		}
+		if len(urls.Urls) != expected {
+			t.Errorf("Part %d has %d URLs", part+1, len(urls.Urls))
+		}
+		num_urls += len(urls.Urls)
+	}
+	if num_urls != 5 {
+		t.Errorf("Parts have %d URLs", num_urls)
+	}
+
+	for _, path := range []string{"/sitemap/0.xml", "/sitemap/4.xml", "/sitemap/9223372036854775807.xml",
+		"/sitemap/4611686018427387905.xml", "/sitemap/99999999999999999999.xml"} {
+		w = httptest.NewRecorder()
+		sitemapPartHandler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Status %d for %s", w.Code, path)
+		}
+	}
+}
+
+func TestSitemapWithoutParts(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "first", `{"Title": "First", "DateCreated": "2020-01-01 10:00"}`, "Body")
+	writeTestArticle(t, "draft", `{"Title": "Draft", "DateCreated": "2020-01-01 10:00", "Status": "draft"}`, "Body")
+
+	w := httptest.NewRecorder()
+	sitemapHandler(w, httptest.NewRequest("GET", "/sitemap.xml", nil))
+	urls := SitemapUrlSet{}
+	if err := xml.Unmarshal(w.Body.Bytes(), &urls); err != nil {
+		t.Fatal(err)
+	}
+	if len(urls.Urls) != 3 {
+		t.Errorf("Sitemap has %d URLs, drafts are not included", len(urls.Urls))
+	}
+
+	w = httptest.NewRecorder()
+	sitemapPartHandler(w, httptest.NewRequest("GET", "/sitemap/1.xml", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status %d for a part of a sitemap which is not split", w.Code)
+	}
+}
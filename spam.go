@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// Comments with at least this score wait for moderation
+	defaultSpamModerateScore = 1.0
+	// Comments with at least this score are rejected
+	defaultSpamRejectScore = 3.0
+
+	defaultSpamMinSeconds = 5
+	defaultSpamMaxLinks   = 2
+	// Form tokens older than this are not accepted
+	formTokenMaxAge = 24 * time.Hour
+
+	formTokenName = "buq2_form"
+	// Hidden field which only bots fill
+	honeypotField = "website"
+)
+
+// Comment which is checked for spam
+type SpamCheck struct {
+	Comment  Comment
+	Request  *http.Request
+	RemoteIp string
+}
+
+// Rule of the spam filter
+type SpamRule interface {
+	// Returns spam score of the comment, and reason if the score is not zero
+	Score(check *SpamCheck) (float64, string)
+}
+
+type SpamResult struct {
+	Score   float64
+	Reasons []string
+}
+
+// Rules used for new comments, set by initSpamFilter
+var spamRules []SpamRule
+
+var linkPattern = regexp.MustCompile("(?i)(https?://|www\\.|\\]\\()")
+
+// Filled honeypot field means that the form was filled by a bot
+type HoneypotRule struct{}
+
+func (rule HoneypotRule) Score(check *SpamCheck) (float64, string) {
+	if len(check.Request.FormValue(honeypotField)) > 0 {
+		return 10, "honeypot field filled"
+	}
+	return 0, ""
+}
+
+// Humans take some time to read and write. The form contains a signed
+// time when the page was loaded.
+type TimeOnPageRule struct {
+	MinSeconds int
+}
+
+func (rule TimeOnPageRule) Score(check *SpamCheck) (float64, string) {
+	token := check.Request.FormValue("form_token")
+	if len(token) == 0 {
+		// Token is added with JavaScript, a missing token alone must
+		// not send the comment to moderation
+		return spamModerateScore() / 2, "no form token"
+	}
+	loaded, err := parseFormToken(token)
+	if err != nil {
+		return 1, "invalid form token"
+	}
+	elapsed := time.Since(loaded)
+	if elapsed > formTokenMaxAge {
+		return 1, "form token expired"
+	}
+	if elapsed < time.Duration(rule.MinSeconds)*time.Second {
+		return 2, fmt.Sprintf("sent %.1f seconds after loading the page", elapsed.Seconds())
+	}
+	return 0, ""
+}
+
+// Spam tends to consist of links
+type LinkDensityRule struct {
+	MaxLinks int
+}
+
+func (rule LinkDensityRule) Score(check *SpamCheck) (float64, string) {
+	num_links := len(linkPattern.FindAllString(check.Comment.CommentBody, -1))
+	num_words := len(strings.Fields(check.Comment.CommentBody))
+	score := 0.0
+	if num_links > rule.MaxLinks {
+		score += 0.5 * float64(num_links-rule.MaxLinks)
+	}
+	if num_links > 0 && num_words < 4*num_links {
+		score += 1
+	}
+	if score > 0 {
+		return score, fmt.Sprintf("%d links in %d words", num_links, num_words)
+	}
+	return 0, ""
+}
+
+type BannedWordsRule struct {
+	Words []string
+}
+
+func (rule BannedWordsRule) Score(check *SpamCheck) (float64, string) {
+	text := strings.ToLower(check.Comment.Name + " " + check.Comment.CommentBody)
+	score := 0.0
+	found := []string{}
+	for _, word := range rule.Words {
+		if len(word) > 0 && strings.Contains(text, strings.ToLower(word)) {
+			score += 2
+			found = append(found, word)
+		}
+	}
+	if score > 0 {
+		return score, "banned words: " + strings.Join(found, ", ")
+	}
+	return 0, ""
+}
+
+type BannedIpRule struct {
+	Networks []*net.IPNet
+}
+
+func (rule BannedIpRule) Score(check *SpamCheck) (float64, string) {
+	ip := net.ParseIP(check.RemoteIp)
+	if ip == nil {
+		return 0, ""
+	}
+	for _, network := range rule.Networks {
+		if network.Contains(ip) {
+			return 10, "banned address " + check.RemoteIp
+		}
+	}
+	return 0, ""
+}
+
+func spamModerateScore() float64 {
+	if siteGlobal.SpamModerateScore <= 0 {
+		return defaultSpamModerateScore
+	}
+	return siteGlobal.SpamModerateScore
+}
+
+func spamRejectScore() float64 {
+	if siteGlobal.SpamRejectScore <= 0 {
+		return defaultSpamRejectScore
+	}
+	return siteGlobal.SpamRejectScore
+}
+
+// Creates the spam rules from the site config
+func initSpamFilter() error {
+	min_seconds := siteGlobal.SpamMinSeconds
+	if min_seconds <= 0 {
+		min_seconds = defaultSpamMinSeconds
+	}
+	max_links := siteGlobal.SpamMaxLinks
+	if max_links <= 0 {
+		max_links = defaultSpamMaxLinks
+	}
+	banned_networks, err := parseNetworks(siteGlobal.SpamBannedIps)
+	if err != nil {
+		return err
+	}
+
+	spamClassifier = NewSpamClassifier(getSpamModelFilename())
+	err = spamClassifier.Load()
+	if err != nil {
+		return err
+	}
+
+	spamRules = []SpamRule{
+		HoneypotRule{},
+		TimeOnPageRule{min_seconds},
+		LinkDensityRule{max_links},
+		BannedWordsRule{siteGlobal.SpamBannedWords},
+		BannedIpRule{banned_networks},
+		spamClassifier,
+	}
+	return nil
+}
+
+// Runs all spam rules for the comment
+func checkSpam(r *http.Request, comment Comment) SpamResult {
+	check := &SpamCheck{comment, r, clientIp(r)}
+	result := SpamResult{}
+	for _, rule := range spamRules {
+		score, reason := rule.Score(check)
+		if score > 0 {
+			result.Score += score
+			result.Reasons = append(result.Reasons, reason)
+		}
+	}
+	return result
+}
+
+func (result SpamResult) Reason() string {
+	return fmt.Sprintf("spam score %.1f: ", result.Score) + strings.Join(result.Reasons, "; ")
+}
+
+// Sets status of the new comment based on its spam score
+func applySpamResult(comment *Comment, result SpamResult) {
+	if result.Score >= spamRejectScore() {
+		comment.Status = commentStatusRejected
+	} else if result.Score >= spamModerateScore() {
+		comment.Status = commentStatusPending
+	} else {
+		return
+	}
+	comment.SpamReason = result.Reason()
+	log.Print("Comment from " + comment.Name + " is " + comment.Status + ", " + comment.SpamReason)
+}
+
+func newFormToken() (string, error) {
+	return secureCookie.Encode(formTokenName, time.Now().UnixNano())
+}
+
+// Returns time when the form token was created
+func parseFormToken(token string) (time.Time, error) {
+	if len(token) == 0 {
+		return time.Time{}, errors.New("No form token")
+	}
+	created := int64(0)
+	err := secureCookie.Decode(formTokenName, token, &created)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, created), nil
+}
+
+// Returns signed time stamp for the comment form. Fetched when the page is
+// loaded, as the pages are cached.
+func formTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := newFormToken()
+	if err != nil {
+		log.Print("Failed to create form token: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(token))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+)
+
+const (
+	defaultSpamModel = "/spam_model.json"
+	// Classifier is not used before it has seen this many comments of
+	// both kinds
+	spamMinTrainingComments = 10
+
+	spamTrainedSpam = "spam"
+	spamTrainedHam  = "ham"
+)
+
+// Naive Bayes classifier trained with the moderation decisions
+type SpamClassifier struct {
+	Filename string
+
+	mutex sync.Mutex
+	model spamModel
+}
+
+// Saved state of the classifier
+type spamModel struct {
+	SpamComments int
+	HamComments  int
+	// Number of comments of each kind containing the word
+	SpamWords map[string]int
+	HamWords  map[string]int
+}
+
+var spamClassifier *SpamClassifier
+
+func getSpamModelFilename() string {
+	if len(siteGlobal.SpamModelFile) > 0 {
+		return siteGlobal.SpamModelFile
+	}
+	return siteGlobal.ContentRoot + defaultSpamModel
+}
+
+func NewSpamClassifier(filename string) *SpamClassifier {
+	classifier := new(SpamClassifier)
+	classifier.Filename = filename
+	classifier.model.SpamWords = make(map[string]int)
+	classifier.model.HamWords = make(map[string]int)
+	return classifier
+}
+
+// Reads the model, untrained model is used if the file does not exist
+func (classifier *SpamClassifier) Load() error {
+	classifier.mutex.Lock()
+	defer classifier.mutex.Unlock()
+
+	data, err := ioutil.ReadFile(classifier.Filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &classifier.model)
+}
+
+// Writes the model. Caller must hold the mutex.
+func (classifier *SpamClassifier) save() error {
+	data, err := json.Marshal(classifier.model)
+	if err != nil {
+		return err
+	}
+	temporary := classifier.Filename + ".tmp"
+	err = ioutil.WriteFile(temporary, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary, classifier.Filename)
+}
+
+// Each word is counted once per comment
+func spamWords(comment Comment) []string {
+	seen := make(map[string]bool)
+	words := []string{}
+	for _, word := range tokenize(comment.Name + " " + comment.CommentBody) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// Adds the comment to the model as spam or ham. Negative count removes
+// a comment which was added earlier, used when the admin changes their
+// mind.
+func (classifier *SpamClassifier) Train(comment Comment, is_spam bool, count int) error {
+	classifier.mutex.Lock()
+	defer classifier.mutex.Unlock()
+
+	counts := classifier.model.HamWords
+	total := &classifier.model.HamComments
+	if is_spam {
+		counts = classifier.model.SpamWords
+		total = &classifier.model.SpamComments
+	}
+
+	*total += count
+	if *total < 0 {
+		*total = 0
+	}
+	for _, word := range spamWords(comment) {
+		counts[word] += count
+		if counts[word] <= 0 {
+			delete(counts, word)
+		}
+	}
+
+	return classifier.save()
+}
+
+// Returns probability that the comment is spam, and false if the model
+// has not been trained enough
+func (classifier *SpamClassifier) SpamProbability(comment Comment) (float64, bool) {
+	classifier.mutex.Lock()
+	defer classifier.mutex.Unlock()
+
+	model := &classifier.model
+	if model.SpamComments < spamMinTrainingComments || model.HamComments < spamMinTrainingComments {
+		return 0, false
+	}
+
+	// Log probabilities, words are smoothed with add-one smoothing
+	spam := math.Log(float64(model.SpamComments))
+	ham := math.Log(float64(model.HamComments))
+	for _, word := range spamWords(comment) {
+		spam += math.Log(float64(model.SpamWords[word]+1) / float64(model.SpamComments+2))
+		ham += math.Log(float64(model.HamWords[word]+1) / float64(model.HamComments+2))
+	}
+
+	return 1 / (1 + math.Exp(ham-spam)), true
+}
+
+func (classifier *SpamClassifier) Score(check *SpamCheck) (float64, string) {
+	probability, trained := classifier.SpamProbability(check.Comment)
+	if !trained || probability < 0.7 {
+		return 0, ""
+	}
+	reason := fmt.Sprintf("classifier spam probability %.2f", probability)
+	if probability < 0.9 {
+		return 1, reason
+	}
+	return 2, reason
+}
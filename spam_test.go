@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func spamCheckOfForm(form url.Values, body string) *SpamCheck {
+	r := httptest.NewRequest("POST", "/article/first", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return &SpamCheck{Comment{CommentBody: body}, r, "192.0.2.1"}
+}
+
+func TestTimeOnPageRule(t *testing.T) {
+	setupTestCookies(t)
+	rule := TimeOnPageRule{5}
+
+	score, _ := rule.Score(spamCheckOfForm(url.Values{}, "Hello"))
+	if score <= 0 || score >= spamModerateScore() {
+		t.Errorf("Missing form token scored %v", score)
+	}
+
+	score, _ = rule.Score(spamCheckOfForm(url.Values{"form_token": {"forged"}}, "Hello"))
+	if score < spamModerateScore() {
+		t.Errorf("Invalid form token scored %v", score)
+	}
+
+	token, err := newFormToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score, _ = rule.Score(spamCheckOfForm(url.Values{"form_token": {token}}, "Hello"))
+	if score < spamModerateScore() {
+		t.Errorf("Form sent right after loading scored %v", score)
+	}
+
+	old_token, _ := secureCookie.Encode(formTokenName, time.Now().Add(-time.Minute).UnixNano())
+	score, _ = rule.Score(spamCheckOfForm(url.Values{"form_token": {old_token}}, "Hello"))
+	if score != 0 {
+		t.Errorf("Form sent after a minute scored %v", score)
+	}
+}
+
+func TestSpamRules(t *testing.T) {
+	banned, err := parseNetworks([]string{"198.51.100.0/24", "203.0.113.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rule   SpamRule
+		form   url.Values
+		body   string
+		remote string
+		spam   bool
+	}{
+		{HoneypotRule{}, url.Values{honeypotField: {"http://spam.example"}}, "Hello", "", true},
+		{HoneypotRule{}, url.Values{}, "Hello", "", false},
+		{LinkDensityRule{2}, url.Values{}, "See http://a.example", "", true},
+		{LinkDensityRule{2}, url.Values{}, "A longer comment which mentions http://a.example once", "", false},
+		{BannedWordsRule{[]string{"Casino"}}, url.Values{}, "Best casino bonus", "", true},
+		{BannedWordsRule{[]string{"casino", ""}}, url.Values{}, "Nice article", "", false},
+		{BannedIpRule{banned}, url.Values{}, "Hello", "198.51.100.20", true},
+		{BannedIpRule{banned}, url.Values{}, "Hello", "203.0.113.7", true},
+		{BannedIpRule{banned}, url.Values{}, "Hello", "203.0.113.8", false},
+	}
+	for _, test := range tests {
+		check := spamCheckOfForm(test.form, test.body)
+		check.RemoteIp = test.remote
+		score, reason := test.rule.Score(check)
+		if (score > 0) != test.spam {
+			t.Errorf("%T scored %v for '%s' from %s", test.rule, score, test.body, test.remote)
+		}
+		if (score > 0) != (len(reason) > 0) {
+			t.Errorf("%T gave reason '%s' with score %v", test.rule, reason, score)
+		}
+	}
+}
+
+func TestApplySpamResult(t *testing.T) {
+	setupTestContent(t)
+	tests := map[float64]string{
+		0:                   commentStatusApproved,
+		spamModerateScore(): commentStatusPending,
+		spamRejectScore():   commentStatusRejected,
+	}
+	for score, status := range tests {
+		comment := Comment{Status: commentStatusApproved}
+		applySpamResult(&comment, SpamResult{score, []string{"test"}})
+		if comment.Status != status {
+			t.Errorf("Score %v gave status %s", score, comment.Status)
+		}
+		if (status == commentStatusApproved) != (len(comment.SpamReason) == 0) {
+			t.Errorf("Score %v gave reason '%s'", score, comment.SpamReason)
+		}
+	}
+}
+
+func TestSpamClassifier(t *testing.T) {
+	root := setupTestContent(t)
+	classifier := NewSpamClassifier(root + "/model.json")
+
+	spam := Comment{CommentBody: "cheap pills casino bonus"}
+	ham := Comment{CommentBody: "thanks for the clear explanation of the algorithm"}
+	if _, trained := classifier.SpamProbability(spam); trained {
+		t.Error("Untrained classifier gave a probability")
+	}
+	for i := 0; i < spamMinTrainingComments; i++ {
+		classifier.Train(spam, true, 1)
+		classifier.Train(ham, false, 1)
+	}
+
+	if probability, _ := classifier.SpamProbability(Comment{CommentBody: "casino pills"}); probability < 0.9 {
+		t.Errorf("Spam probability of spam is %v", probability)
+	}
+	if probability, _ := classifier.SpamProbability(Comment{CommentBody: "clear algorithm"}); probability > 0.1 {
+		t.Errorf("Spam probability of ham is %v", probability)
+	}
+
+	// Model is saved on every change
+	loaded := NewSpamClassifier(classifier.Filename)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.model.SpamComments != spamMinTrainingComments || loaded.model.SpamWords["casino"] != spamMinTrainingComments {
+		t.Errorf("Loaded model %+v", loaded.model)
+	}
+
+	// Removing the training forgets the words
+	for i := 0; i < spamMinTrainingComments; i++ {
+		classifier.Train(spam, true, -1)
+	}
+	if classifier.model.SpamComments != 0 || len(classifier.model.SpamWords) != 0 {
+		t.Errorf("Model after removing spam %+v", classifier.model)
+	}
+}
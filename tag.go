@@ -5,27 +5,53 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"strings"
 )
 
 type TagData struct {
 	SiteGlobal
+	PageData
 	Articles Articles
 	Tag      string
 }
 
-var validTag = regexp.MustCompile("^/(tag)/([a-zA-Z0-9_ ]+)$")
+var validTag = regexp.MustCompile("^/(tag)/([a-zA-Z0-9_ ]+)(/page/([0-9]+))?$")
 
-func getTag(r *http.Request) (string, error) {
+// Returns the tag in the form used for comparing. Tags are matched without
+// case, such that tag pages, search filters and related articles agree on
+// which articles have the tag.
+func normalizeTag(tag string) string {
+	return strings.ToLower(tag)
+}
+
+// Returns true if the tag is in the tags
+func hasTag(tags []string, tag string) bool {
+	for _, other := range tags {
+		if normalizeTag(other) == normalizeTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func getTag(r *http.Request) (string, int, error) {
 	m := validTag.FindStringSubmatch(r.URL.Path)
 	if m == nil {
-		return "", errors.New("Invalid tag from request: " + r.URL.Path)
+		return "", 0, errors.New("Invalid tag from request: " + r.URL.Path)
 	}
 
-	return m[2], nil // The tag is the second subexpression.
+	// The tag is the second subexpression and page number the fourth
+	page, err := parsePageNumber(m[4])
+	return m[2], page, err
 }
 
 func tagHandler(w http.ResponseWriter, r *http.Request) {
-	tag, err := getTag(r)
+	if validTagFeed.MatchString(r.URL.Path) {
+		tagFeedHandler(w, r)
+		return
+	}
+
+	tag, page, err := getTag(r)
 	if err != nil {
 		http.NotFound(w, r)
 		log.Print("Could not parse tag from request:" + err.Error())
@@ -38,9 +64,18 @@ func tagHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	articles, pagination, err := paginateArticles(articles, page, "/tag/"+tag)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
 	data := TagData{}
 	data.Tag = tag
 	data.SiteGlobal = siteGlobal
+	data.PageData = newPageData()
+	data.Pagination = pagination
+	data.Feeds = getTagFeedLinks(tag)
 	data.Articles = SplitRawArticlesIntoColumns(articles)
 
 	renderTemplate(w, "tag", data)
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tag pages and search filters find the same articles for a tag
+func TestTagIsMatchedWithoutCase(t *testing.T) {
+	setupTestContent(t)
+	writeTestArticle(t, "upper", `{"Title": "Upper", "DateCreated": "2020-01-01 10:00", "Tags": ["Go"]}`, "Body")
+	writeTestArticle(t, "lower", `{"Title": "Lower", "DateCreated": "2020-01-02 10:00", "Tags": ["go"]}`, "Body")
+	writeTestArticle(t, "other", `{"Title": "Other", "DateCreated": "2020-01-03 10:00", "Tags": ["golang"]}`, "Body")
+
+	for _, tag := range []string{"go", "Go", "GO"} {
+		tagged, _ := GetArticlesByTag(tag)
+		searched := NewSearchIndex(GetAllArticles()).Search("tag:" + tag)
+		if len(tagged) != 2 || len(searched) != 2 {
+			t.Errorf("Tag %s: %d articles on the tag page, %d searched", tag, len(tagged), len(searched))
+		}
+	}
+
+	if tags := getAllTags(GetAllArticles()); len(tags) != 2 {
+		t.Errorf("Tags %v, tags differing by case have one page", tags)
+	}
+
+	w := httptest.NewRecorder()
+	tagHandler(w, httptest.NewRequest("GET", "/tag/GO", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "/article/upper") || !strings.Contains(body, "/article/lower") ||
+		strings.Contains(body, "/article/other") {
+		t.Error("Tag page does not list the articles with the tag")
+	}
+}